@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/bazookajoe1/metrics-collector/internal/collector"
+	"github.com/bazookajoe1/metrics-collector/internal/config"
+	"github.com/bazookajoe1/metrics-collector/internal/encryption"
 	httpagent "github.com/bazookajoe1/metrics-collector/internal/http-agent"
 	"github.com/bazookajoe1/metrics-collector/internal/metric"
 )
@@ -45,9 +50,73 @@ var allowedMetrics = [][2]string{
 func main() {
 	logger := log.New(os.Stdout, "", log.Flags())
 
+	cfg, err := config.LoadAgentConfig(os.Args[1:])
+	if err != nil {
+		logger.Fatal(err)
+	}
+	host, port, err := config.SplitAddress(cfg.Address)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
 	collectorInst := collector.NewCollector(logger, allowedMetrics)
+	if len(cfg.PauseBuckets) > 0 {
+		pauses, err := collector.NewPauseSource(cfg.PauseBuckets)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		collectorInst.AddSource(pauses, 0)
+	}
+	if len(cfg.RuntimeMetrics) > 0 {
+		runtimeSource, err := collector.NewRuntimeSource(cfg.RuntimeMetrics)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		collectorInst.AddSource(runtimeSource, 0)
+	}
+	if cfg.SystemMetrics {
+		collectorInst.AddSource(collector.NewSystemSource(""), 0)
+	}
+	for name, interval := range cfg.SourceIntervals {
+		if err := collectorInst.SetInterval(name, interval.Duration); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	agent := httpagent.AgentNew(host, port, collectorInst, cfg.PollInterval.Duration, cfg.ReportInterval.Duration, logger)
+	agent.Compress = cfg.Gzip
+	agent.Key = cfg.Key
+	agent.Retries = cfg.Retries
+	agent.RetryBackoff = cfg.RetryBackoff.Duration
+	agent.SetBufferSize(cfg.BufferSize)
+	agent.Workers = cfg.Workers
+	agent.Labels = cfg.Labels
+	agent.SetRateLimit(cfg.RateLimit)
+	if cfg.CryptoKey != "" {
+		agent.PublicKey, err = encryption.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
 
-	agent := httpagent.AgentNew("localhost", "8080", collectorInst, 2, 10, logger)
+	if cfg.Transport == config.TransportGRPC {
+		transport, err := httpagent.NewGRPCTransport(cfg.GRPCAddress)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer transport.Close()
+		transport.Stream = cfg.GRPCStream
+		transport.Compress = cfg.Gzip
+		transport.Key = cfg.Key
+		agent.Transport = transport
+	}
 
-	agent.Run()
+	agent.Run(ctx)
+	logger.Println("agent stopped")
 }
@@ -1,25 +1,151 @@
 package main
 
 import (
+	"context"
+	"io"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"github.com/bazookajoe1/metrics-collector/internal/alerting"
+	"github.com/bazookajoe1/metrics-collector/internal/config"
+	"github.com/bazookajoe1/metrics-collector/internal/encryption"
+	"github.com/bazookajoe1/metrics-collector/internal/graphite"
+	grpcserver "github.com/bazookajoe1/metrics-collector/internal/grpc-server"
 	httpserver "github.com/bazookajoe1/metrics-collector/internal/http-server"
+	"github.com/bazookajoe1/metrics-collector/internal/statsd"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/filestorage"
 	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/pgstorage"
 )
 
 func main() {
 	// TODO: create logger
 	logger := log.New(os.Stdout, "", log.Flags())
+
+	cfg, err := config.LoadServerConfig(os.Args[1:])
+	if err != nil {
+		logger.Fatal(err)
+	}
+	host, port, err := config.SplitAddress(cfg.Address)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
 	// TODO: init storage
-	servStorage := memstorage.NewInMemoryStorage()
+	var servStorage httpserver.Storage
+	var storageCloser io.Closer
+	if cfg.DatabaseDSN != "" {
+		pgStorage, err := pgstorage.NewPgStorage(cfg.DatabaseDSN, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		pgStorage.SetHistoryRetention(cfg.HistorySize, cfg.HistoryAge.Duration)
+		go pgStorage.Run(ctx)
+		servStorage, storageCloser = pgStorage, pgStorage
+	} else {
+		memStorage := memstorage.NewInMemoryStorage()
+		memStorage.SetHistoryRetention(cfg.HistorySize, cfg.HistoryAge.Duration)
+		fileStorage, err := filestorage.NewFileStorage(memStorage, cfg.FileStoragePath, cfg.StoreInterval.Duration, cfg.Restore, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		go fileStorage.Run(ctx)
+		servStorage, storageCloser = fileStorage, fileStorage
+	}
 
 	// TODO: init http server
-	server := httpserver.ServerNew("localhost", "8080", servStorage, logger)
+	server := httpserver.ServerNew(host, port, servStorage, logger)
+	server.Key = cfg.Key
+	server.InfluxCounterSuffixes = cfg.InfluxCounters
+	server.InfluxUnsigned = cfg.InfluxUnsigned
+	if cfg.CryptoKey != "" {
+		server.PrivateKey, err = encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if cfg.AlertRules != "" {
+		alertCfg, err := alerting.Load(cfg.AlertRules)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		engine := alerting.NewEngine(alertCfg.Rules, servStorage, logger)
+		if len(alertCfg.Notifications.Channels) > 0 {
+			notifier, err := alerting.NewNotifier(alertCfg.Notifications, logger)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			engine.Notifier = notifier
+			server.Silencer = notifier
+		}
+		go engine.Run(ctx, cfg.AlertInterval.Duration)
+		server.Alerter = engine
+	}
+
+	// statsd, graphite и grpc пишут в хранилище напрямую, поэтому останавливаем его до закрытия хранилища
+	var ingestWG sync.WaitGroup
+	if cfg.StatsdAddress != "" {
+		listener := statsd.NewListener(cfg.StatsdAddress, cfg.StatsdFlush.Duration, servStorage, logger)
+		if err := listener.Listen(); err != nil {
+			logger.Fatal(err)
+		}
+		ingestWG.Add(1)
+		go func() {
+			defer ingestWG.Done()
+			listener.Serve(ctx)
+		}()
+	}
+	if cfg.GraphiteAddress != "" {
+		listener := graphite.NewListener(cfg.GraphiteAddress, servStorage, logger)
+		if err := listener.Listen(); err != nil {
+			logger.Fatal(err)
+		}
+		ingestWG.Add(1)
+		go func() {
+			defer ingestWG.Done()
+			listener.Serve(ctx)
+		}()
+	}
+
+	if cfg.GRPCAddress != "" {
+		grpcServer := grpcserver.ServerNew(cfg.GRPCAddress, servStorage, logger)
+		grpcServer.Key = cfg.Key
+		grpcListener, err := net.Listen("tcp", cfg.GRPCAddress)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		ingestWG.Add(1)
+		go func() {
+			defer ingestWG.Done()
+			if err := grpcServer.Serve(ctx, grpcListener); err != nil {
+				logger.Println(err)
+			}
+		}()
+	}
 
 	// TODO: register handlers
 	server.InitRoutes()
 
 	// TODO: run server
-	server.Run()
+	runErr := server.Run(ctx)
+
+	stop()
+	ingestWG.Wait()
+
+	// запросы завершены, сохраняем все, что успели получить
+	if err := storageCloser.Close(); err != nil {
+		logger.Println(err)
+	}
+	if runErr != nil {
+		logger.Fatal(runErr)
+	}
+	logger.Println("server stopped")
 }
@@ -0,0 +1,195 @@
+package alerting
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Channel types
+const (
+	ChannelWebhook = "webhook" // POST of Notification as JSON
+	ChannelSlack   = "slack"   // POST of Slack incoming webhook message
+	ChannelSMTP    = "smtp"    // plain text email
+)
+
+const channelTimeout = 10 * time.Second
+
+// ChannelConfig describes one notification channel. URL is used by webhook and slack,
+// the rest by smtp.
+type ChannelConfig struct {
+	Name     string   `json:"name" yaml:"name"`
+	Type     string   `json:"type" yaml:"type"`
+	URL      string   `json:"url" yaml:"url"`
+	Address  string   `json:"address" yaml:"address"` // SMTP server host:port
+	From     string   `json:"from" yaml:"from"`
+	To       []string `json:"to" yaml:"to"`
+	Username string   `json:"username" yaml:"username"` // PLAIN auth is used when set
+	Password string   `json:"password" yaml:"password"`
+}
+
+func (cfg *ChannelConfig) validate() error {
+	if cfg.Name == "" {
+		return errors.New("name is empty")
+	}
+	switch cfg.Type {
+	case ChannelWebhook, ChannelSlack:
+		if cfg.URL == "" {
+			return errors.New("url is empty")
+		}
+	case ChannelSMTP:
+		if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+			return fmt.Errorf("address: %w", err)
+		}
+		if cfg.From == "" || len(cfg.To) == 0 {
+			return errors.New("from and to must be set")
+		}
+	default:
+		return fmt.Errorf("unknown channel type %q", cfg.Type)
+	}
+	return nil
+}
+
+// Creates channel described by cfg
+func NewChannel(cfg ChannelConfig) (Channel, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("channel %s: %w", cfg.Name, err)
+	}
+	switch cfg.Type {
+	case ChannelWebhook:
+		return &webhookChannel{name: cfg.Name, url: cfg.URL, client: resty.New().SetTimeout(channelTimeout)}, nil
+	case ChannelSlack:
+		return &slackChannel{webhookChannel{name: cfg.Name, url: cfg.URL, client: resty.New().SetTimeout(channelTimeout)}}, nil
+	default:
+		return &smtpChannel{
+			name:     cfg.Name,
+			address:  cfg.Address,
+			from:     cfg.From,
+			to:       cfg.To,
+			username: cfg.Username,
+			password: cfg.Password,
+		}, nil
+	}
+}
+
+type webhookChannel struct {
+	name   string
+	url    string
+	client *resty.Client
+}
+
+func (ch *webhookChannel) Name() string { return ch.name }
+
+func (ch *webhookChannel) Send(ctx context.Context, n *Notification) error {
+	return ch.post(ctx, n)
+}
+
+func (ch *webhookChannel) post(ctx context.Context, body any) error {
+	resp, err := ch.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(ch.url)
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("webhook responded %s", resp.Status())
+	}
+	return nil
+}
+
+type slackChannel struct {
+	webhookChannel
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (ch *slackChannel) Send(ctx context.Context, n *Notification) error {
+	return ch.post(ctx, slackMessage{Text: fmt.Sprintf("*%s*\n%s", n.Title(), n.Text())})
+}
+
+type smtpChannel struct {
+	name     string
+	address  string
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func (ch *smtpChannel) Name() string { return ch.name }
+
+func (ch *smtpChannel) Send(ctx context.Context, n *Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, channelTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", ch.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(ch.address)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if ch.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", ch.username, ch.password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(ch.from); err != nil {
+		return err
+	}
+	for _, to := range ch.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(ch.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (ch *smtpChannel) message(n *Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", ch.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(ch.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", n.Title())
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(n.Text(), "\n", "\r\n"))
+	return []byte(b.String())
+}
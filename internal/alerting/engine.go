@@ -0,0 +1,199 @@
+package alerting
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Alert states
+const (
+	StatePending  = "pending"  // condition holds, but not for long enough yet
+	StateFiring   = "firing"   // condition holds for at least For of the rule
+	StateResolved = "resolved" // condition stopped holding after the alert fired
+)
+
+// How long resolved alerts are shown before they are forgotten
+const resolvedRetention = 15 * time.Minute
+
+// Storage the rules are evaluated against
+type Storage interface {
+	ListMetrics() ([]*metric.Metric, error)
+}
+
+// Alert is the state of one rule for one series
+type Alert struct {
+	Rule        string        `json:"rule"`
+	Metric      string        `json:"metric"`
+	Type        string        `json:"type"`
+	Labels      metric.Labels `json:"labels,omitempty"`
+	Severity    string        `json:"severity"`
+	Description string        `json:"description,omitempty"`
+	State       string        `json:"state"`
+	Value       float64       `json:"value"` // the last evaluated value
+	Op          string        `json:"op"`
+	Threshold   float64       `json:"threshold"`
+	ActiveSince time.Time     `json:"active_since"`
+	FiredAt     *time.Time    `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time    `json:"resolved_at,omitempty"`
+}
+
+// Returns key that identifies the alert: rule name and series
+func (a *Alert) Key() string {
+	return a.Rule + "/" + metric.SeriesKey(a.Metric, a.Labels)
+}
+
+// Receives alerts after every evaluation
+type Notifier interface {
+	Notify(ctx context.Context, alerts []Alert)
+}
+
+type engine struct {
+	Rules    []Rule
+	Strg     Storage
+	Notifier Notifier // optional
+	Logger   *log.Logger
+
+	mu     sync.RWMutex
+	alerts map[string]*Alert // by Alert.Key
+	now    func() time.Time
+}
+
+func NewEngine(rules []Rule, storage Storage, logger *log.Logger) *engine {
+	return &engine{
+		Rules:  rules,
+		Strg:   storage,
+		Logger: logger,
+		alerts: make(map[string]*Alert),
+		now:    time.Now,
+	}
+}
+
+// Evaluates all rules once and updates alert states
+func (e *engine) Evaluate() error {
+	metrics, err := e.Strg.ListMetrics()
+	if err != nil {
+		return err
+	}
+	now := e.now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active := make(map[string]bool)
+	for i := range e.Rules {
+		rule := &e.Rules[i]
+		for _, m := range metrics {
+			mName, mType, mValue := m.GetParams()
+			labels := m.Labels()
+			if mName != rule.Metric || mType != rule.Type || !rule.matches(labels) {
+				continue
+			}
+			value, err := strconv.ParseFloat(mValue, 64)
+			if err != nil {
+				e.Logger.Printf("rule %s: %v", rule.Name, err)
+				continue
+			}
+			if !comparisons[rule.Op](value, rule.Threshold) {
+				continue
+			}
+
+			alert := &Alert{Rule: rule.Name, Metric: mName, Labels: labels}
+			key := alert.Key()
+			active[key] = true
+			if existing, ok := e.alerts[key]; ok && existing.State != StateResolved {
+				alert = existing
+			} else {
+				*alert = Alert{
+					Rule:        rule.Name,
+					Metric:      mName,
+					Type:        mType,
+					Labels:      labels,
+					Severity:    rule.Severity,
+					Description: rule.Description,
+					State:       StatePending,
+					Op:          rule.Op,
+					Threshold:   rule.Threshold,
+					ActiveSince: now,
+				}
+				e.alerts[key] = alert
+				e.logTransition(alert, "inactive", value)
+			}
+			alert.Value = value
+
+			if alert.State == StatePending && now.Sub(alert.ActiveSince) >= rule.For.Duration {
+				alert.State = StateFiring
+				firedAt := now
+				alert.FiredAt = &firedAt
+				e.logTransition(alert, StatePending, value)
+			}
+		}
+	}
+
+	// условие больше не выполняется или метрика пропала
+	for key, alert := range e.alerts {
+		if active[key] {
+			continue
+		}
+		switch alert.State {
+		case StatePending:
+			delete(e.alerts, key)
+			e.Logger.Printf("alert %s: pending -> inactive", key)
+		case StateFiring:
+			alert.State = StateResolved
+			resolvedAt := now
+			alert.ResolvedAt = &resolvedAt
+			e.logTransition(alert, StateFiring, alert.Value)
+		case StateResolved:
+			if now.Sub(*alert.ResolvedAt) > resolvedRetention {
+				delete(e.alerts, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *engine) logTransition(alert *Alert, from string, value float64) {
+	e.Logger.Printf("alert %s: %s -> %s, value %g %s %g, severity %s",
+		alert.Key(), from, alert.State, value, alert.Op, alert.Threshold, alert.Severity)
+}
+
+// Returns copies of all known alerts sorted by rule and series
+func (e *engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Key() < alerts[j].Key()
+	})
+	return alerts
+}
+
+// Evaluates rules every interval until ctx is done and hands alerts over to Notifier
+func (e *engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Evaluate(); err != nil {
+			e.Logger.Println("alerting:", err)
+		} else if e.Notifier != nil {
+			e.Notifier.Notify(ctx, e.Alerts())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
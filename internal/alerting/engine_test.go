@@ -0,0 +1,150 @@
+package alerting
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/config"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - name: high_alloc
+    metric: Alloc
+    op: ">"
+    threshold: 100
+    for: 1m
+  - name: many_polls
+    metric: PollCount
+    type: counter
+    labels:
+      host: a
+    op: ">="
+    threshold: 10
+    severity: critical
+`), 0o600))
+
+	file, err := Load(path)
+	require.NoError(t, err)
+	rules := file.Rules
+	require.Len(t, rules, 2)
+	assert.Equal(t, metric.Gauge, rules[0].Type)
+	assert.Equal(t, "warning", rules[0].Severity)
+	assert.Equal(t, time.Minute, rules[0].For.Duration)
+	assert.Equal(t, metric.Labels{"host": "a"}, rules[1].Labels)
+
+	for name, content := range map[string]string{
+		"op":        `{"rules": [{"name": "a", "metric": "Alloc", "op": "=>"}]}`,
+		"type":      `{"rules": [{"name": "a", "metric": "Alloc", "type": "histogram", "op": ">"}]}`,
+		"duplicate": `{"rules": [{"name": "a", "metric": "Alloc", "op": ">"}, {"name": "a", "metric": "Sys", "op": ">"}]}`,
+		"no metric": `{"rules": [{"name": "a", "op": ">"}]}`,
+	} {
+		path := filepath.Join(dir, "bad.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := Load(path)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEngine_States(t *testing.T) {
+	strg := memstorage.NewInMemoryStorage()
+	rules := []Rule{{
+		Name:      "high_alloc",
+		Metric:    "Alloc",
+		Type:      metric.Gauge,
+		Op:        ">",
+		Threshold: 100,
+		For:       config.Duration{Duration: time.Minute},
+		Severity:  "critical",
+	}}
+	e := NewEngine(rules, strg, log.New(io.Discard, "", 0))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	setAlloc := func(value string, labels metric.Labels) {
+		m, err := metric.NewMetric("Alloc", metric.Gauge, value)
+		require.NoError(t, err)
+		require.NoError(t, m.SetLabels(labels))
+		require.NoError(t, strg.UpdateMetric(m))
+	}
+
+	// нет метрики - нет алертов
+	require.NoError(t, e.Evaluate())
+	assert.Empty(t, e.Alerts())
+
+	setAlloc("150", nil)
+	setAlloc("50", metric.Labels{"host": "b"})
+	require.NoError(t, e.Evaluate())
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Equal(t, 150.0, alerts[0].Value)
+	assert.Nil(t, alerts[0].FiredAt)
+
+	// условие перестало выполняться до истечения for
+	setAlloc("90", nil)
+	now = now.Add(30 * time.Second)
+	require.NoError(t, e.Evaluate())
+	assert.Empty(t, e.Alerts())
+
+	setAlloc("200", nil)
+	require.NoError(t, e.Evaluate())
+	now = now.Add(time.Minute)
+	require.NoError(t, e.Evaluate())
+	alerts = e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, "critical", alerts[0].Severity)
+	require.NotNil(t, alerts[0].FiredAt)
+	assert.Equal(t, now, *alerts[0].FiredAt)
+
+	setAlloc("10", nil)
+	now = now.Add(time.Second)
+	require.NoError(t, e.Evaluate())
+	alerts = e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateResolved, alerts[0].State)
+	require.NotNil(t, alerts[0].ResolvedAt)
+
+	// снова сработавший алерт начинается с pending
+	setAlloc("300", nil)
+	require.NoError(t, e.Evaluate())
+	alerts = e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Nil(t, alerts[0].ResolvedAt)
+
+	setAlloc("10", nil)
+	require.NoError(t, e.Evaluate())
+	assert.Empty(t, e.Alerts())
+}
+
+func TestEngine_LabelSelector(t *testing.T) {
+	strg := memstorage.NewInMemoryStorage()
+	for _, labels := range []metric.Labels{nil, {"host": "a"}, {"host": "b"}} {
+		m, err := metric.NewMetric("PollCount", metric.Counter, "20")
+		require.NoError(t, err)
+		require.NoError(t, m.SetLabels(labels))
+		require.NoError(t, strg.UpdateMetric(m))
+	}
+
+	rules := []Rule{{Name: "polls", Metric: "PollCount", Type: metric.Counter, Labels: metric.Labels{"host": "a"}, Op: ">=", Threshold: 20}}
+	e := NewEngine(rules, strg, log.New(io.Discard, "", 0))
+	require.NoError(t, e.Evaluate())
+
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, metric.Labels{"host": "a"}, alerts[0].Labels)
+}
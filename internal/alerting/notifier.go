@@ -0,0 +1,297 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/config"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// NotifierConfig describes where and how often notifications are sent
+type NotifierConfig struct {
+	// Alerts with equal values of these fields go into one notification.
+	// Fields are rule, metric, type, severity or names of series labels.
+	GroupBy []string `json:"group_by" yaml:"group_by"`
+	// How often a notification about still firing alerts is repeated
+	RepeatInterval config.Duration `json:"repeat_interval" yaml:"repeat_interval"`
+	Channels       []ChannelConfig `json:"channels" yaml:"channels"`
+}
+
+func DefaultNotifierConfig() NotifierConfig {
+	return NotifierConfig{
+		GroupBy:        []string{"rule"},
+		RepeatInterval: config.Duration{Duration: 4 * time.Hour},
+	}
+}
+
+func (cfg *NotifierConfig) validate() error {
+	if cfg.RepeatInterval.Duration <= 0 {
+		return errors.New("repeat interval must be positive")
+	}
+	names := make(map[string]bool, len(cfg.Channels))
+	for i := range cfg.Channels {
+		ch := &cfg.Channels[i]
+		if err := ch.validate(); err != nil {
+			return fmt.Errorf("channel %d %s: %w", i+1, ch.Name, err)
+		}
+		if names[ch.Name] {
+			return fmt.Errorf("channel %s is duplicated", ch.Name)
+		}
+		names[ch.Name] = true
+	}
+	return nil
+}
+
+// Notification tells about firing and just resolved alerts of one group
+type Notification struct {
+	Status      string            `json:"status"` // firing if some alert is firing, resolved otherwise
+	GroupLabels map[string]string `json:"group_labels"`
+	Alerts      []Alert           `json:"alerts"`
+}
+
+// Returns short summary, e.g. "[FIRING:2] rule=high_alloc"
+func (n *Notification) Title() string {
+	firing := 0
+	for _, alert := range n.Alerts {
+		if alert.State == StateFiring {
+			firing++
+		}
+	}
+	title := fmt.Sprintf("[%s:%d]", strings.ToUpper(n.Status), firing)
+	if n.Status == StateResolved {
+		title = fmt.Sprintf("[%s]", strings.ToUpper(n.Status))
+	}
+	if len(n.GroupLabels) > 0 {
+		title += " " + metric.Labels(n.GroupLabels).String()
+	}
+	return title
+}
+
+// Returns one line per alert, e.g. "firing Alloc{host="a"} = 150 > 100 (critical)"
+func (n *Notification) Text() string {
+	var b strings.Builder
+	for _, alert := range n.Alerts {
+		fmt.Fprintf(&b, "%s %s = %g %s %g (%s)", alert.State, metric.SeriesKey(alert.Metric, alert.Labels),
+			alert.Value, alert.Op, alert.Threshold, alert.Severity)
+		if alert.Description != "" {
+			fmt.Fprintf(&b, ": %s", alert.Description)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Channel delivers notifications, e.g. to a webhook or by email
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+// What was last delivered about a group to a channel
+type groupState struct {
+	firing   map[string]bool // keys of firing alerts
+	lastSent time.Time
+}
+
+type notifier struct {
+	Channels       []Channel
+	GroupBy        []string
+	RepeatInterval time.Duration
+	Logger         *log.Logger
+
+	mu       sync.Mutex // protects silences
+	silences map[string]*Silence
+
+	sendMu sync.Mutex             // serializes Notify calls
+	sent   map[string]*groupState // by channel name and group key
+	now    func() time.Time
+}
+
+func NewNotifier(cfg NotifierConfig, logger *log.Logger) (*notifier, error) {
+	n := &notifier{
+		GroupBy:        cfg.GroupBy,
+		RepeatInterval: cfg.RepeatInterval.Duration,
+		Logger:         logger,
+		silences:       make(map[string]*Silence),
+		sent:           make(map[string]*groupState),
+		now:            time.Now,
+	}
+	for _, chCfg := range cfg.Channels {
+		ch, err := NewChannel(chCfg)
+		if err != nil {
+			return nil, err
+		}
+		n.Channels = append(n.Channels, ch)
+	}
+	return n, nil
+}
+
+// Sends notifications about alerts that started firing or got resolved since the last notification
+// of their group, and repeats notifications about firing alerts every RepeatInterval.
+// Pending and silenced alerts are not notified about. Delivery that failed is retried on the next call.
+func (n *notifier) Notify(ctx context.Context, alerts []Alert) {
+	n.sendMu.Lock()
+	defer n.sendMu.Unlock()
+
+	now := n.now()
+	groups := make(map[string][]Alert)
+	groupLabels := make(map[string]map[string]string)
+	for _, alert := range alerts {
+		if alert.State == StatePending || n.silenced(&alert, now) {
+			continue
+		}
+		labels := n.groupLabels(&alert)
+		key := metric.Labels(labels).String()
+		groups[key] = append(groups[key], alert)
+		groupLabels[key] = labels
+	}
+
+	for _, ch := range n.Channels {
+		for key, group := range groups {
+			n.notifyGroup(ctx, ch, key, groupLabels[key], group, now)
+		}
+		// группы, в которых не осталось алертов, больше не отслеживаем
+		prefix := ch.Name() + "/"
+		for stateKey := range n.sent {
+			if key, ok := strings.CutPrefix(stateKey, prefix); ok && groups[key] == nil {
+				delete(n.sent, stateKey)
+			}
+		}
+	}
+}
+
+func (n *notifier) notifyGroup(ctx context.Context, ch Channel, key string, labels map[string]string, group []Alert, now time.Time) {
+	stateKey := ch.Name() + "/" + key
+	state, ok := n.sent[stateKey]
+	if !ok {
+		state = &groupState{firing: make(map[string]bool)}
+	}
+
+	firing := make(map[string]bool)
+	notification := &Notification{Status: StateResolved, GroupLabels: labels}
+	changed := false
+	for _, alert := range group {
+		alertKey := alert.Key()
+		switch {
+		case alert.State == StateFiring:
+			firing[alertKey] = true
+			notification.Status = StateFiring
+			notification.Alerts = append(notification.Alerts, alert)
+			changed = changed || !state.firing[alertKey]
+		case state.firing[alertKey]:
+			// о срабатывании сообщали, значит сообщаем и о разрешении
+			notification.Alerts = append(notification.Alerts, alert)
+			changed = true
+		}
+	}
+
+	repeat := len(firing) > 0 && now.Sub(state.lastSent) >= n.RepeatInterval
+	if !changed && !repeat {
+		return
+	}
+
+	if err := ch.Send(ctx, notification); err != nil {
+		n.Logger.Printf("notification %s to %s: %v", notification.Title(), ch.Name(), err)
+		return
+	}
+	n.Logger.Printf("notification %s sent to %s", notification.Title(), ch.Name())
+
+	state.firing = firing
+	state.lastSent = now
+	n.sent[stateKey] = state
+}
+
+func (n *notifier) groupLabels(alert *Alert) map[string]string {
+	labels := make(map[string]string, len(n.GroupBy))
+	for _, name := range n.GroupBy {
+		switch name {
+		case "rule":
+			labels[name] = alert.Rule
+		case "metric":
+			labels[name] = alert.Metric
+		case "type":
+			labels[name] = alert.Type
+		case "severity":
+			labels[name] = alert.Severity
+		default:
+			if value, ok := alert.Labels[name]; ok {
+				labels[name] = value
+			}
+		}
+	}
+	return labels
+}
+
+// Returns active silences sorted by end time
+func (n *notifier) Silences() []Silence {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.now()
+	silences := make([]Silence, 0, len(n.silences))
+	for id, s := range n.silences {
+		if now.After(s.EndsAt) {
+			delete(n.silences, id)
+			continue
+		}
+		silences = append(silences, *s)
+	}
+	sort.Slice(silences, func(i, j int) bool {
+		if !silences[i].EndsAt.Equal(silences[j].EndsAt) {
+			return silences[i].EndsAt.Before(silences[j].EndsAt)
+		}
+		return silences[i].ID < silences[j].ID
+	})
+	return silences
+}
+
+// Validates the silence, assigns it an id and starts applying it. Zero StartsAt means now.
+func (n *notifier) AddSilence(s Silence) (Silence, error) {
+	if s.StartsAt.IsZero() {
+		s.StartsAt = n.now()
+	}
+	if err := s.validate(); err != nil {
+		return Silence{}, err
+	}
+	id, err := newSilenceID()
+	if err != nil {
+		return Silence{}, err
+	}
+	s.ID = id
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.silences[s.ID] = &s
+	return s, nil
+}
+
+// Stops applying the silence
+func (n *notifier) DeleteSilence(id string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.silences[id]; !ok {
+		return ErrSilenceNotFound
+	}
+	delete(n.silences, id)
+	return nil
+}
+
+func (n *notifier) silenced(alert *Alert, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, s := range n.silences {
+		if s.active(now) && s.matches(alert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package alerting
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/config"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Webhook stand-in that records received bodies
+type webhookServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []string
+	status int
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	ws := &webhookServer{status: http.StatusOK}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		if ws.status == http.StatusOK {
+			ws.bodies = append(ws.bodies, string(body))
+		}
+		res.WriteHeader(ws.status)
+	}))
+	t.Cleanup(ws.Close)
+	return ws
+}
+
+func (ws *webhookServer) notifications(t *testing.T) []Notification {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	out := make([]Notification, 0, len(ws.bodies))
+	for _, body := range ws.bodies {
+		var n Notification
+		require.NoError(t, json.Unmarshal([]byte(body), &n))
+		out = append(out, n)
+	}
+	return out
+}
+
+func testAlert(rule, state string, labels metric.Labels) Alert {
+	return Alert{Rule: rule, Metric: "Alloc", Type: metric.Gauge, Labels: labels, Severity: "warning", State: state, Value: 150, Op: ">", Threshold: 100}
+}
+
+func newTestNotifier(t *testing.T, channels ...ChannelConfig) (*notifier, *time.Time) {
+	cfg := DefaultNotifierConfig()
+	cfg.RepeatInterval = config.Duration{Duration: time.Hour}
+	cfg.Channels = channels
+	require.NoError(t, cfg.validate())
+
+	n, err := NewNotifier(cfg, log.New(io.Discard, "", 0))
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	return n, &now
+}
+
+func TestNotifier_Webhook(t *testing.T) {
+	ws := newWebhookServer(t)
+	n, now := newTestNotifier(t, ChannelConfig{Name: "hook", Type: ChannelWebhook, URL: ws.URL})
+	ctx := context.Background()
+
+	hostA := testAlert("high_alloc", StateFiring, metric.Labels{"host": "a"})
+	hostB := testAlert("high_alloc", StateFiring, metric.Labels{"host": "b"})
+	pending := testAlert("low_sys", StatePending, nil)
+
+	// оба алерта одного правила приходят одним уведомлением, pending не отправляется
+	n.Notify(ctx, []Alert{hostA, hostB, pending})
+	sent := ws.notifications(t)
+	require.Len(t, sent, 1)
+	assert.Equal(t, StateFiring, sent[0].Status)
+	assert.Equal(t, map[string]string{"rule": "high_alloc"}, sent[0].GroupLabels)
+	assert.Len(t, sent[0].Alerts, 2)
+
+	// то же самое повторно не отправляется до истечения repeat interval
+	*now = now.Add(time.Minute)
+	n.Notify(ctx, []Alert{hostA, hostB, pending})
+	assert.Len(t, ws.notifications(t), 1)
+
+	*now = now.Add(time.Hour)
+	n.Notify(ctx, []Alert{hostA, hostB})
+	assert.Len(t, ws.notifications(t), 2)
+
+	hostB.State = StateResolved
+	n.Notify(ctx, []Alert{hostA, hostB})
+	sent = ws.notifications(t)
+	require.Len(t, sent, 3)
+	assert.Equal(t, StateFiring, sent[2].Status)
+	assert.Equal(t, StateResolved, sent[2].Alerts[1].State)
+
+	// о разрешении сообщается один раз
+	hostA.State = StateResolved
+	n.Notify(ctx, []Alert{hostA, hostB})
+	n.Notify(ctx, []Alert{hostA, hostB})
+	sent = ws.notifications(t)
+	require.Len(t, sent, 4)
+	assert.Equal(t, StateResolved, sent[3].Status)
+	require.Len(t, sent[3].Alerts, 1)
+	assert.Equal(t, "a", sent[3].Alerts[0].Labels["host"])
+}
+
+func TestNotifier_RetriesFailedDelivery(t *testing.T) {
+	ws := newWebhookServer(t)
+	ws.status = http.StatusInternalServerError
+	n, _ := newTestNotifier(t, ChannelConfig{Name: "hook", Type: ChannelWebhook, URL: ws.URL})
+
+	alerts := []Alert{testAlert("high_alloc", StateFiring, nil)}
+	n.Notify(context.Background(), alerts)
+	assert.Empty(t, ws.notifications(t))
+
+	ws.mu.Lock()
+	ws.status = http.StatusOK
+	ws.mu.Unlock()
+	n.Notify(context.Background(), alerts)
+	assert.Len(t, ws.notifications(t), 1)
+}
+
+func TestNotifier_Silences(t *testing.T) {
+	ws := newWebhookServer(t)
+	n, now := newTestNotifier(t, ChannelConfig{Name: "hook", Type: ChannelWebhook, URL: ws.URL})
+
+	_, err := n.AddSilence(Silence{EndsAt: now.Add(time.Hour)})
+	assert.Error(t, err, "silence without matchers")
+	_, err = n.AddSilence(Silence{Rule: "high_alloc", EndsAt: now.Add(-time.Hour)})
+	assert.Error(t, err, "silence ending before it starts")
+
+	silence, err := n.AddSilence(Silence{Labels: metric.Labels{"host": "a"}, EndsAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.NotEmpty(t, silence.ID)
+	assert.Equal(t, *now, silence.StartsAt)
+	assert.Len(t, n.Silences(), 1)
+
+	alerts := []Alert{testAlert("high_alloc", StateFiring, metric.Labels{"host": "a"})}
+	n.Notify(context.Background(), alerts)
+	assert.Empty(t, ws.notifications(t))
+
+	require.NoError(t, n.DeleteSilence(silence.ID))
+	assert.ErrorIs(t, n.DeleteSilence(silence.ID), ErrSilenceNotFound)
+	n.Notify(context.Background(), alerts)
+	assert.Len(t, ws.notifications(t), 1)
+
+	// истекший silence пропадает из списка
+	_, err = n.AddSilence(Silence{Rule: "high_alloc", EndsAt: now.Add(time.Minute)})
+	require.NoError(t, err)
+	*now = now.Add(2 * time.Minute)
+	assert.Empty(t, n.Silences())
+}
+
+func TestNotifier_Slack(t *testing.T) {
+	ws := newWebhookServer(t)
+	n, _ := newTestNotifier(t, ChannelConfig{Name: "slack", Type: ChannelSlack, URL: ws.URL})
+
+	n.Notify(context.Background(), []Alert{testAlert("high_alloc", StateFiring, metric.Labels{"host": "a"})})
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	require.Len(t, ws.bodies, 1)
+	var msg slackMessage
+	require.NoError(t, json.Unmarshal([]byte(ws.bodies[0]), &msg))
+	assert.Contains(t, msg.Text, `[FIRING:1] rule="high_alloc"`)
+	assert.Contains(t, msg.Text, `firing Alloc{host="a"} = 150 > 100 (warning)`)
+}
+
+// Minimal SMTP server that accepts one message per connection and passes its data to messages
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			messages <- data.String()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestNotifier_SMTP(t *testing.T) {
+	addr, messages := fakeSMTPServer(t)
+	n, _ := newTestNotifier(t, ChannelConfig{
+		Name:    "mail",
+		Type:    ChannelSMTP,
+		Address: addr,
+		From:    "alerts@example.com",
+		To:      []string{"ops@example.com"},
+	})
+
+	n.Notify(context.Background(), []Alert{testAlert("high_alloc", StateFiring, nil)})
+
+	select {
+	case msg := <-messages:
+		assert.Contains(t, msg, "To: ops@example.com")
+		assert.Contains(t, msg, `Subject: [FIRING:1] rule="high_alloc"`)
+		assert.Contains(t, msg, "firing Alloc = 150 > 100 (warning)")
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not delivered")
+	}
+}
+
+func TestNotifierConfig_Validate(t *testing.T) {
+	for name, ch := range map[string]ChannelConfig{
+		"no name":   {Type: ChannelWebhook, URL: "http://localhost"},
+		"no url":    {Name: "a", Type: ChannelSlack},
+		"bad type":  {Name: "a", Type: "pager", URL: "http://localhost"},
+		"bad addr":  {Name: "a", Type: ChannelSMTP, Address: "localhost", From: "a@b", To: []string{"c@d"}},
+		"no sender": {Name: "a", Type: ChannelSMTP, Address: "localhost:25", To: []string{"c@d"}},
+	} {
+		cfg := DefaultNotifierConfig()
+		cfg.Channels = []ChannelConfig{ch}
+		assert.Error(t, cfg.validate(), name)
+	}
+}
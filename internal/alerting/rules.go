@@ -0,0 +1,110 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/bazookajoe1/metrics-collector/internal/config"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+const defaultSeverity = "warning"
+
+// Rule fires an alert for every series of the metric whose value satisfies the comparison
+// with the threshold for at least For. Labels, if set, select only series having all of them.
+type Rule struct {
+	Name        string          `json:"name" yaml:"name"`
+	Metric      string          `json:"metric" yaml:"metric"`
+	Type        string          `json:"type" yaml:"type"` // gauge or counter, gauge if empty
+	Labels      metric.Labels   `json:"labels" yaml:"labels"`
+	Op          string          `json:"op" yaml:"op"` // one of > >= < <= == !=
+	Threshold   float64         `json:"threshold" yaml:"threshold"`
+	For         config.Duration `json:"for" yaml:"for"`
+	Severity    string          `json:"severity" yaml:"severity"` // warning if empty
+	Description string          `json:"description" yaml:"description"`
+}
+
+// File is the alerting config: rules and optionally where to send notifications about them
+type File struct {
+	Rules         []Rule         `json:"rules" yaml:"rules"`
+	Notifications NotifierConfig `json:"notifications" yaml:"notifications"`
+}
+
+// Reads alerting config from JSON or YAML file and validates it
+func Load(path string) (*File, error) {
+	file := File{Notifications: DefaultNotifierConfig()}
+	if err := config.LoadFile(path, &file); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(file.Rules))
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d %s: %w", i+1, rule.Name, err)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %s is duplicated", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	if err := file.Notifications.validate(); err != nil {
+		return nil, fmt.Errorf("notifications: %w", err)
+	}
+	return &file, nil
+}
+
+// Checks the rule and fills in defaults
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("name is empty")
+	}
+	if r.Metric == "" {
+		return errors.New("metric is empty")
+	}
+	if r.Type == "" {
+		r.Type = metric.Gauge
+	}
+	if r.Type != metric.Gauge && r.Type != metric.Counter {
+		return fmt.Errorf("type %s can't be compared with a threshold", r.Type)
+	}
+	if _, ok := comparisons[r.Op]; !ok {
+		return fmt.Errorf("unknown comparison %q", r.Op)
+	}
+	if math.IsNaN(r.Threshold) {
+		return errors.New("threshold is NaN")
+	}
+	if r.For.Duration < 0 {
+		return errors.New("for must not be negative")
+	}
+	if r.Severity == "" {
+		r.Severity = defaultSeverity
+	}
+	return r.Labels.Validate()
+}
+
+var comparisons = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// Reports whether series labels contain all labels of the rule
+func (r *Rule) matches(labels metric.Labels) bool {
+	return hasLabels(labels, r.Labels)
+}
+
+// Reports whether labels contain all labels of selector
+func hasLabels(labels, selector metric.Labels) bool {
+	for name, value := range selector {
+		if got, ok := labels[name]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
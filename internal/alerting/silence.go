@@ -0,0 +1,54 @@
+package alerting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+var ErrSilenceNotFound = errors.New("silence not found")
+
+// Silence mutes notifications about alerts of the rule and/or series having all the labels
+// from StartsAt till EndsAt. Silences are kept in memory only.
+type Silence struct {
+	ID        string        `json:"id"`
+	Rule      string        `json:"rule,omitempty"`
+	Labels    metric.Labels `json:"labels,omitempty"`
+	StartsAt  time.Time     `json:"starts_at"`
+	EndsAt    time.Time     `json:"ends_at"`
+	CreatedBy string        `json:"created_by,omitempty"`
+	Comment   string        `json:"comment,omitempty"`
+}
+
+func (s *Silence) validate() error {
+	// пустой silence заглушил бы все алерты, такое скорее ошибка
+	if s.Rule == "" && len(s.Labels) == 0 {
+		return errors.New("silence must match a rule or labels")
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return errors.New("silence must end after it starts")
+	}
+	return s.Labels.Validate()
+}
+
+func (s *Silence) active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+func (s *Silence) matches(alert *Alert) bool {
+	if s.Rule != "" && s.Rule != alert.Rule {
+		return false
+	}
+	return hasLabels(alert.Labels, s.Labels)
+}
+
+func newSilenceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+const randomValue = "RandomValue"
+
+// Sets RandomValue gauge to a random non-zero value
+type randomSource struct{}
+
+func (randomSource) Name() string { return "random" }
+
+func (randomSource) Collect(sink Sink) error {
+	for { // we don't need zero random value
+		value := rand.NormFloat64()
+		if value != 0 {
+			sink.SetGauge(randomValue, strconv.FormatFloat(value, 'f', 3, 64))
+			return nil
+		}
+	}
+}
+
+// Increases counters by one on every poll, e.g. PollCount
+type pollCountSource struct {
+	names []string
+}
+
+func (pollCountSource) Name() string { return "pollcount" }
+
+func (s pollCountSource) Collect(sink Sink) error {
+	for _, name := range s.names {
+		sink.AddCounter(name, 1)
+	}
+	return nil
+}
@@ -1,12 +1,10 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
-	"reflect"
-	"runtime"
-	"strconv"
 	"sync"
 	"time"
 
@@ -14,78 +12,93 @@ import (
 )
 
 type collector struct {
-	stats  map[string]*metric.Metric
-	mux    sync.RWMutex
-	Logger *log.Logger
+	stats   map[string]*metric.Metric
+	mux     sync.RWMutex
+	sources []*registeredSource
+	Logger  *log.Logger
 }
 
 // Create instance of collector and return it. Specify needed metrics in allowedMetrics in the format: [][2]string{ {name, type}, ... }
+// Gauges are MemStats fields or RandomValue, counters are increased by one on every poll.
+// Other sources are added with AddSource.
 func NewCollector(logger *log.Logger, allowedMetrics [][2]string) *collector {
 	c := &collector{Logger: logger}
 	c.stats = make(map[string]*metric.Metric)
+
+	var memStats, counters []string
+	random := false
 	for _, template := range allowedMetrics {
-		metric, err := metric.NewMetric(template[0], template[1], "0")
+		mName, mType := template[0], template[1]
+		_, isMemStats := memStatsGauges[mName]
+		switch {
+		case mType == metric.Counter:
+			counters = append(counters, mName)
+		case mType == metric.Gauge && isMemStats:
+			memStats = append(memStats, mName)
+		case mType == metric.Gauge && mName == randomValue:
+			random = true
+		default:
+			c.Logger.Printf("%s of type %s is not a MemStats field, it stays 0", mName, mType)
+		}
+
+		m, err := metric.NewMetric(mName, mType, "0")
 		if err != nil {
 			c.Logger.Fatal(err)
 		}
-		c.stats[template[0]] = metric
+		c.stats[mName] = m
+	}
+
+	if len(memStats) > 0 {
+		c.AddSource(&memStatsSource{names: memStats}, 0)
+	}
+	if random {
+		c.AddSource(randomSource{}, 0)
+	}
+	if len(counters) > 0 {
+		c.AddSource(pollCountSource{names: counters}, 0)
 	}
 
 	return c
 }
 
+// Calls every source once. Errors of the sources are returned together.
 func (c *collector) CollectMetrics() error {
-	var stats runtime.MemStats
-	runtime.ReadMemStats(&stats)
-
-	c.mux.Lock()
-	defer c.mux.Unlock()
-	reflectedStatValues := reflect.ValueOf(stats)
-	for key := range c.stats {
-		val := reflectedStatValues.FieldByName(key)
-		if val.IsValid() { // смотрим есть такое поле в струкутуре
-			err := c.stats[key].UpdateMetric(fmt.Sprintf("%v", reflectedStatValues.FieldByName(key)))
-			if err != nil {
-				c.Logger.Println(err)
-			}
-		}
-		_, mType, _ := c.stats[key].GetParams()
-		if mType == metric.Counter { // сделаем обновления сразу для всех counter
-			err := c.stats[key].UpdateMetric("1")
-			if err != nil {
-				c.Logger.Println(err)
-			}
-		}
-	}
-
-	for { // we don't need zero random value
-		randomValue := rand.NormFloat64()
-		if randomValue != 0 {
-			c.stats["RandomValue"].UpdateMetric(strconv.FormatFloat(float64(randomValue), 'f', 3, 64))
-			break
+	var errs []error
+	for _, rs := range c.sources {
+		if err := c.collect(rs); err != nil {
+			errs = append(errs, fmt.Errorf("source %s: %w", rs.source.Name(), err))
 		}
 	}
-
-	return nil
+	return errors.Join(errs...)
 }
 
 func (c *collector) GetMetrics() []*metric.Metric {
 	metrics := make([]*metric.Metric, 0, len(c.stats))
 	c.mux.RLock()
 	for _, metric := range c.stats {
-		metrics = append(metrics, metric)
+		snapshot := *metric // отдаем копию, чтобы сборщик не менял значения во время отправки
+		metrics = append(metrics, &snapshot)
 	}
 	c.mux.RUnlock()
 	return metrics
 
 }
 
-func (c *collector) Run(pollInterval time.Duration) {
-	for {
-		err := c.CollectMetrics()
-		if err != nil {
-			c.Logger.Println(err)
+// Runs every source in its own goroutine on its interval until ctx is done.
+// Sources without interval are collected every pollInterval.
+func (c *collector) Run(ctx context.Context, pollInterval time.Duration) {
+	wg := sync.WaitGroup{}
+	for _, rs := range c.sources {
+		interval := rs.interval
+		if interval <= 0 {
+			interval = pollInterval
 		}
-		time.Sleep(pollInterval * time.Second)
+
+		wg.Add(1)
+		go func(rs *registeredSource) {
+			defer wg.Done()
+			c.runSource(ctx, rs, interval)
+		}(rs)
 	}
+	wg.Wait()
 }
@@ -1,11 +1,18 @@
 package collector
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log"
+	"runtime"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // What metrics we need to collect (name, type)
@@ -152,3 +159,145 @@ func TestCollector_CollectMetrics(t *testing.T) {
 // 		})
 // 	}
 // }
+
+func TestCollectMetrics_PauseHistogram(t *testing.T) {
+	c := NewCollector(log.New(io.Discard, "", 0), [][2]string{{"RandomValue", metric.Gauge}})
+	pauses, err := NewPauseSource([]float64{1e4, 1e6})
+	require.NoError(t, err)
+	c.AddSource(pauses, 0)
+
+	runtime.GC()
+	require.NoError(t, c.CollectMetrics())
+	first := pauseHistogramOf(t, c)
+	assert.Positive(t, first.Count)
+
+	runtime.GC()
+	runtime.GC()
+	require.NoError(t, c.CollectMetrics())
+	second := pauseHistogramOf(t, c)
+	// every GC cycle is observed once
+	assert.GreaterOrEqual(t, second.Count, first.Count+2)
+	assert.Equal(t, []float64{1e4, 1e6}, second.Bounds)
+}
+
+func pauseHistogramOf(t *testing.T, c *collector) *metric.HistogramValue {
+	for _, m := range c.GetMetrics() {
+		mName, mType, mValue := m.GetParams()
+		if mName == pauseHistogram {
+			require.Equal(t, metric.Histogram, mType)
+			h, err := metric.ParseHistogram(mValue)
+			require.NoError(t, err)
+			return h
+		}
+	}
+	t.Fatal("no pause histogram")
+	return nil
+}
+
+func TestCollectMetrics_Runtime(t *testing.T) {
+	c := NewCollector(log.New(io.Discard, "", 0), allowedMetrics)
+	_, err := NewRuntimeSource([]string{"/no/such:metric"})
+	require.Error(t, err)
+	source, err := NewRuntimeSource([]string{
+		"/sched/goroutines:goroutines",
+		"/gc/cycles/total:gc-cycles",
+		"/gc/heap/allocs-by-size:bytes",
+	})
+	require.NoError(t, err)
+	c.AddSource(source, 0)
+
+	runtime.GC()
+	require.NoError(t, c.CollectMetrics())
+
+	types := make(map[string]string)
+	values := make(map[string]string)
+	for _, m := range c.GetMetrics() {
+		mName, mType, mValue := m.GetParams()
+		types[mName], values[mName] = mType, mValue
+	}
+
+	assert.Equal(t, metric.Gauge, types["go_sched_goroutines"])
+	goroutines, err := strconv.Atoi(values["go_sched_goroutines"])
+	require.NoError(t, err)
+	assert.Positive(t, goroutines)
+
+	// cumulative value is a counter total, agent sends its increments
+	assert.Equal(t, metric.Counter, types["go_gc_cycles_total_gc_cycles"])
+	assert.NotEqual(t, "0", values["go_gc_cycles_total_gc_cycles"])
+
+	assert.Equal(t, metric.Histogram, types["go_gc_heap_allocs_by_size_bytes"])
+	h, err := metric.ParseHistogram(values["go_gc_heap_allocs_by_size_bytes"])
+	require.NoError(t, err)
+	assert.Positive(t, h.Count)
+	assert.Positive(t, h.Sum)
+
+	// MemStats names are still collected
+	assert.NotEqual(t, "0", values["HeapAlloc"])
+	assert.Equal(t, "1", values["Pollcount"])
+}
+
+func TestRuntimeMetricName(t *testing.T) {
+	for name, want := range map[string]string{
+		"/sched/goroutines:goroutines":                     "go_sched_goroutines",
+		"/gc/heap/allocs:bytes":                            "go_gc_heap_allocs_bytes",
+		"/gc/heap/allocs:objects":                          "go_gc_heap_allocs_objects",
+		"/cpu/classes/gc/total:cpu-seconds":                "go_cpu_classes_gc_total_cpu_seconds",
+		"/godebug/non-default-behavior/http2client:events": "go_godebug_non_default_behavior_http2client_events",
+	} {
+		assert.Equal(t, want, runtimeMetricName(name), name)
+	}
+}
+
+// Source that fails, panics or reports a gauge depending on the call number
+type flakySource struct {
+	calls int
+}
+
+func (*flakySource) Name() string { return "flaky" }
+
+func (s *flakySource) Collect(sink Sink) error {
+	s.calls++
+	sink.SetGauge("Flaky", strconv.Itoa(s.calls))
+	switch s.calls {
+	case 1:
+		return errors.New("temporary failure")
+	case 2:
+		panic("broken source")
+	}
+	return nil
+}
+
+func TestCollector_SourceErrorsAreIsolated(t *testing.T) {
+	c := NewCollector(log.New(io.Discard, "", 0), [][2]string{{"PollCount", metric.Counter}})
+	flaky := &flakySource{}
+	c.AddSource(flaky, 0)
+
+	// other sources are applied, values of the failed call are not
+	assert.ErrorContains(t, c.CollectMetrics(), "temporary failure")
+	assert.Equal(t, "1", readGauge(t, c, "PollCount"))
+	c.mux.RLock()
+	_, ok := c.stats["Flaky"]
+	c.mux.RUnlock()
+	assert.False(t, ok)
+
+	assert.ErrorContains(t, c.CollectMetrics(), "panic: broken source")
+	assert.Equal(t, "2", readGauge(t, c, "PollCount"))
+
+	assert.NoError(t, c.CollectMetrics())
+	assert.Equal(t, "3", readGauge(t, c, "Flaky"))
+}
+
+func TestCollector_RunSourcesOnOwnIntervals(t *testing.T) {
+	c := NewCollector(log.New(io.Discard, "", 0), [][2]string{{"PollCount", metric.Counter}})
+	c.AddSource(NewSystemSource(t.TempDir()), 0) // no procfs there, the source stops
+	require.Error(t, c.SetInterval("unknown", time.Second))
+	require.NoError(t, c.SetInterval("pollcount", 10*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	c.Run(ctx, time.Hour)
+
+	polls, err := strconv.Atoi(readGauge(t, c, "PollCount"))
+	require.NoError(t, err)
+	assert.Greater(t, polls, 5)
+}
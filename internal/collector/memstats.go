@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"runtime"
+	"strconv"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+func formatUint(v uint64) string { return strconv.FormatUint(v, 10) }
+
+// MemStats fields available as gauges under their field names. Kept for compatibility with
+// the reports of older agents, runtime/metrics names cover the rest of runtime statistics.
+var memStatsGauges = map[string]func(*runtime.MemStats) string{
+	"Alloc":         func(s *runtime.MemStats) string { return formatUint(s.Alloc) },
+	"BuckHashSys":   func(s *runtime.MemStats) string { return formatUint(s.BuckHashSys) },
+	"Frees":         func(s *runtime.MemStats) string { return formatUint(s.Frees) },
+	"GCCPUFraction": func(s *runtime.MemStats) string { return strconv.FormatFloat(s.GCCPUFraction, 'f', -1, 64) },
+	"GCSys":         func(s *runtime.MemStats) string { return formatUint(s.GCSys) },
+	"HeapAlloc":     func(s *runtime.MemStats) string { return formatUint(s.HeapAlloc) },
+	"HeapIdle":      func(s *runtime.MemStats) string { return formatUint(s.HeapIdle) },
+	"HeapInuse":     func(s *runtime.MemStats) string { return formatUint(s.HeapInuse) },
+	"HeapObjects":   func(s *runtime.MemStats) string { return formatUint(s.HeapObjects) },
+	"HeapReleased":  func(s *runtime.MemStats) string { return formatUint(s.HeapReleased) },
+	"HeapSys":       func(s *runtime.MemStats) string { return formatUint(s.HeapSys) },
+	"LastGC":        func(s *runtime.MemStats) string { return formatUint(s.LastGC) },
+	"Lookups":       func(s *runtime.MemStats) string { return formatUint(s.Lookups) },
+	"MCacheInuse":   func(s *runtime.MemStats) string { return formatUint(s.MCacheInuse) },
+	"MCacheSys":     func(s *runtime.MemStats) string { return formatUint(s.MCacheSys) },
+	"MSpanInuse":    func(s *runtime.MemStats) string { return formatUint(s.MSpanInuse) },
+	"MSpanSys":      func(s *runtime.MemStats) string { return formatUint(s.MSpanSys) },
+	"Mallocs":       func(s *runtime.MemStats) string { return formatUint(s.Mallocs) },
+	"NextGC":        func(s *runtime.MemStats) string { return formatUint(s.NextGC) },
+	"NumForcedGC":   func(s *runtime.MemStats) string { return formatUint(uint64(s.NumForcedGC)) },
+	"NumGC":         func(s *runtime.MemStats) string { return formatUint(uint64(s.NumGC)) },
+	"OtherSys":      func(s *runtime.MemStats) string { return formatUint(s.OtherSys) },
+	"PauseTotalNs":  func(s *runtime.MemStats) string { return formatUint(s.PauseTotalNs) },
+	"StackInuse":    func(s *runtime.MemStats) string { return formatUint(s.StackInuse) },
+	"StackSys":      func(s *runtime.MemStats) string { return formatUint(s.StackSys) },
+	"Sys":           func(s *runtime.MemStats) string { return formatUint(s.Sys) },
+	"TotalAlloc":    func(s *runtime.MemStats) string { return formatUint(s.TotalAlloc) },
+}
+
+// Reads chosen MemStats fields as gauges
+type memStatsSource struct {
+	names []string
+}
+
+func (*memStatsSource) Name() string { return "memstats" }
+
+func (s *memStatsSource) Collect(sink Sink) error {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	for _, name := range s.names {
+		sink.SetGauge(name, memStatsGauges[name](&stats))
+	}
+	return nil
+}
+
+// Name of the histogram of GC pauses in nanoseconds
+const pauseHistogram = "PauseNs"
+
+// Observes GC pauses from MemStats.PauseNs into PauseNs histogram
+type pauseSource struct {
+	histogram *metric.HistogramValue
+	lastNumGC uint32 // GC cycles already observed
+}
+
+// Creates source of GC pause histogram with the given bucket bounds in nanoseconds
+func NewPauseSource(bounds []float64) (*pauseSource, error) {
+	h, err := metric.NewHistogramValue(bounds)
+	if err != nil {
+		return nil, err
+	}
+	return &pauseSource{histogram: h}, nil
+}
+
+func (*pauseSource) Name() string { return "gcpauses" }
+
+// Adds GC pauses that happened since the previous call to the histogram
+func (s *pauseSource) Collect(sink Sink) error {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	// PauseNs хранит только последние size пауз, пауза цикла n лежит в [(n+size-1)%size]
+	size := uint32(len(stats.PauseNs))
+	from := s.lastNumGC
+	if stats.NumGC-from > size {
+		from = stats.NumGC - size
+	}
+	for n := from + 1; n <= stats.NumGC; n++ {
+		s.histogram.Observe(float64(stats.PauseNs[(n+size-1)%size]))
+	}
+	s.lastNumGC = stats.NumGC
+
+	sink.SetHistogram(pauseHistogram, s.histogram)
+	return nil
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Reads metrics of runtime/metrics by their canonical names, e.g. /sched/goroutines:goroutines.
+// Canonical names contain / and can't be used in URL paths, so metrics are reported under
+// names like go_sched_goroutines, see runtimeMetricName.
+// Cumulative integer metrics become counters, other numbers become gauges, histograms become histograms.
+type runtimeSource struct {
+	samples    []metrics.Sample
+	names      map[string]string // reported names by canonical ones
+	cumulative map[string]bool
+}
+
+var invalidRuntimeNameChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Converts canonical name to go_ prefixed name of letters, digits and underscores.
+// The unit is kept unless it repeats the last path element:
+// /sched/goroutines:goroutines is go_sched_goroutines, /gc/heap/allocs:bytes is go_gc_heap_allocs_bytes.
+func runtimeMetricName(name string) string {
+	path, unit, _ := strings.Cut(name, ":")
+	elements := strings.Split(strings.Trim(path, "/"), "/")
+	if unit != "" && unit != elements[len(elements)-1] {
+		elements = append(elements, unit)
+	}
+	return "go_" + strings.Trim(invalidRuntimeNameChars.ReplaceAllString(strings.Join(elements, "_"), "_"), "_")
+}
+
+// Creates source of the given runtime metrics. Returns error if some name is not supported by this Go runtime.
+func NewRuntimeSource(names []string) (*runtimeSource, error) {
+	descriptions := make(map[string]metrics.Description)
+	for _, d := range metrics.All() {
+		descriptions[d.Name] = d
+	}
+
+	s := &runtimeSource{
+		samples:    make([]metrics.Sample, 0, len(names)),
+		names:      make(map[string]string, len(names)),
+		cumulative: make(map[string]bool, len(names)),
+	}
+	for _, name := range names {
+		d, ok := descriptions[name]
+		if !ok {
+			return nil, fmt.Errorf("runtime metric %s is not supported", name)
+		}
+		s.samples = append(s.samples, metrics.Sample{Name: name})
+		s.names[name] = runtimeMetricName(name)
+		s.cumulative[name] = d.Cumulative
+	}
+	return s, nil
+}
+
+func (*runtimeSource) Name() string { return "runtime" }
+
+func (s *runtimeSource) Collect(sink Sink) error {
+	metrics.Read(s.samples)
+
+	for _, sample := range s.samples {
+		name := s.names[sample.Name]
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			value := sample.Value.Uint64()
+			if s.cumulative[sample.Name] {
+				// счетчик отдаем нарастающим итогом, агент сам посчитает приращение
+				sink.SetCounter(name, int64(value))
+				continue
+			}
+			sink.SetGauge(name, strconv.FormatUint(value, 10))
+		case metrics.KindFloat64:
+			sink.SetGauge(name, strconv.FormatFloat(sample.Value.Float64(), 'f', -1, 64))
+		case metrics.KindFloat64Histogram:
+			h, err := convertRuntimeHistogram(sample.Value.Float64Histogram())
+			if err != nil {
+				return fmt.Errorf("%s: %w", sample.Name, err)
+			}
+			sink.SetHistogram(name, h)
+		}
+		// KindBad: metric is no longer supported
+	}
+	return nil
+}
+
+// Runtime bucket i holds values in [Buckets[i], Buckets[i+1]), so Buckets[i+1] becomes the upper bound
+// of our bucket i and the last runtime bucket goes above the last bound.
+// Runtime histograms have no sum, it is estimated by bucket midpoints.
+func convertRuntimeHistogram(h *metrics.Float64Histogram) (*metric.HistogramValue, error) {
+	if len(h.Counts) == 0 || len(h.Buckets) != len(h.Counts)+1 {
+		return nil, fmt.Errorf("unexpected histogram with %d counts and %d buckets", len(h.Counts), len(h.Buckets))
+	}
+
+	out, err := metric.NewHistogramValue(h.Buckets[1:len(h.Counts)])
+	if err != nil {
+		return nil, err
+	}
+	for i, count := range h.Counts {
+		out.Counts[i] = count
+		out.Count += count
+		if mid := bucketMidpoint(h.Buckets[i], h.Buckets[i+1]); count > 0 && !math.IsInf(mid, 0) {
+			out.Sum += float64(count) * mid
+		}
+	}
+	return out, nil
+}
+
+func bucketMidpoint(low, high float64) float64 {
+	switch {
+	case math.IsInf(low, -1):
+		return high
+	case math.IsInf(high, 1):
+		return low
+	}
+	return (low + high) / 2
+}
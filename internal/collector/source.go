@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Source collects a group of metrics, e.g. MemStats or host statistics from /proc.
+// Collect is called on the interval of the source and only from one goroutine at a time,
+// so the source may keep state between calls without locking.
+type Source interface {
+	// Unique name of the source, used in logs and to configure its interval
+	Name() string
+	// Writes current values into sink. If an error is returned nothing from this call is applied.
+	Collect(sink Sink) error
+}
+
+// Sink receives values collected by a source
+type Sink interface {
+	// Sets current value of the gauge
+	SetGauge(name, value string)
+	// Adds delta to the counter
+	AddCounter(name string, delta int64)
+	// Sets total value of the counter, e.g. when the source reads a cumulative statistic
+	SetCounter(name string, total int64)
+	// Replaces histogram with the one holding all observations so far
+	SetHistogram(name string, h *metric.HistogramValue)
+}
+
+// Returned by a source that can't work on this host, the source is not called any more
+var ErrUnavailable = errors.New("source is not available")
+
+type registeredSource struct {
+	source   Source
+	interval time.Duration // 0 means poll interval of the collector
+	mu       sync.Mutex    // serializes Collect calls of the source
+}
+
+// Adds source to the collector. Zero interval means poll interval passed to Run.
+// Must be called before Run.
+func (c *collector) AddSource(source Source, interval time.Duration) {
+	c.sources = append(c.sources, &registeredSource{source: source, interval: interval})
+}
+
+// Changes interval of the registered source. Must be called before Run.
+func (c *collector) SetInterval(name string, interval time.Duration) error {
+	for _, rs := range c.sources {
+		if rs.source.Name() == name {
+			rs.interval = interval
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown source %s", name)
+}
+
+// Calls the source once and applies collected values. Panic of the source is returned as error.
+func (c *collector) collect(rs *registeredSource) (err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	var updates sinkBuffer
+	if err := rs.source.Collect(&updates); err != nil {
+		return err
+	}
+	c.apply(rs.source.Name(), updates)
+	return nil
+}
+
+// Collects the source every interval until ctx is done or the source turns out to be unavailable
+func (c *collector) runSource(ctx context.Context, rs *registeredSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := c.collect(rs)
+		if errors.Is(err, ErrUnavailable) {
+			c.Logger.Printf("source %s stopped: %v", rs.source.Name(), err)
+			return
+		}
+		if err != nil {
+			c.Logger.Printf("source %s: %v", rs.source.Name(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sink update waiting to be applied
+type sinkUpdate struct {
+	mType string
+	name  string
+	value string
+	add   bool // counter delta, otherwise the value replaces current one
+}
+
+// sinkBuffer keeps updates of one Collect call, so they are applied at once
+// and the collector lock is not held while the source works
+type sinkBuffer []sinkUpdate
+
+func (b *sinkBuffer) SetGauge(name, value string) {
+	*b = append(*b, sinkUpdate{mType: metric.Gauge, name: name, value: value})
+}
+
+func (b *sinkBuffer) AddCounter(name string, delta int64) {
+	*b = append(*b, sinkUpdate{mType: metric.Counter, name: name, value: strconv.FormatInt(delta, 10), add: true})
+}
+
+func (b *sinkBuffer) SetCounter(name string, total int64) {
+	*b = append(*b, sinkUpdate{mType: metric.Counter, name: name, value: strconv.FormatInt(total, 10)})
+}
+
+func (b *sinkBuffer) SetHistogram(name string, h *metric.HistogramValue) {
+	*b = append(*b, sinkUpdate{mType: metric.Histogram, name: name, value: h.String()})
+}
+
+func (c *collector) apply(source string, updates sinkBuffer) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, u := range updates {
+		if existing, ok := c.stats[u.name]; ok && u.add {
+			if _, mType, _ := existing.GetParams(); mType == u.mType {
+				if err := existing.UpdateMetric(u.value); err != nil {
+					c.Logger.Printf("source %s: %v", source, err)
+				}
+				continue
+			}
+		}
+
+		m, err := metric.NewMetric(u.name, u.mType, u.value)
+		if err != nil {
+			c.Logger.Printf("source %s: %v", source, err)
+			continue
+		}
+		c.stats[u.name] = m
+	}
+}
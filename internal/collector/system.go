@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Where procfs is mounted
+const defaultProcPath = "/proc"
+
+// Accumulated CPU times from /proc/stat in USER_HZ ticks
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// Reads host metrics from procfs and reports them as gauges:
+// TotalMemory, FreeMemory, CPUutilization1..N, LoadAverage1, LoadAverage5, LoadAverage15
+type systemSource struct {
+	ProcPath string // where procfs is mounted
+	prevCPU  []cpuTimes
+}
+
+// Creates source of host metrics, empty procPath means /proc
+func NewSystemSource(procPath string) *systemSource {
+	if procPath == "" {
+		procPath = defaultProcPath
+	}
+	return &systemSource{ProcPath: procPath}
+}
+
+func (*systemSource) Name() string { return "system" }
+
+// Returns ErrUnavailable if procfs is not available on this host
+func (s *systemSource) Collect(sink Sink) error {
+	total, free, err := readMemInfo(filepath.Join(s.ProcPath, "meminfo"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	if err != nil {
+		return err
+	}
+	cpus, err := readCPUTimes(filepath.Join(s.ProcPath, "stat"))
+	if err != nil {
+		return err
+	}
+	loads, err := readLoadAvg(filepath.Join(s.ProcPath, "loadavg"))
+	if err != nil {
+		return err
+	}
+
+	sink.SetGauge("TotalMemory", strconv.FormatUint(total, 10))
+	sink.SetGauge("FreeMemory", strconv.FormatUint(free, 10))
+
+	for i, cpu := range cpus {
+		var utilization float64
+		var prev cpuTimes
+		if i < len(s.prevCPU) {
+			prev = s.prevCPU[i]
+		}
+		if cpu.total > prev.total && cpu.idle >= prev.idle {
+			idle := float64(cpu.idle - prev.idle)
+			utilization = 100 * (1 - idle/float64(cpu.total-prev.total))
+		}
+		sink.SetGauge(fmt.Sprintf("CPUutilization%d", i+1), strconv.FormatFloat(utilization, 'f', 2, 64))
+	}
+	s.prevCPU = cpus
+
+	for i, name := range []string{"LoadAverage1", "LoadAverage5", "LoadAverage15"} {
+		sink.SetGauge(name, loads[i])
+	}
+
+	return nil
+}
+
+// Returns MemTotal and MemFree in bytes
+func readMemInfo(path string) (uint64, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	values, err := parseMemInfo(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, 0, fmt.Errorf("%s: no MemTotal", path)
+	}
+	free, ok := values["MemFree"]
+	if !ok {
+		return 0, 0, fmt.Errorf("%s: no MemFree", path)
+	}
+	return total, free, nil
+}
+
+// Parses lines like "MemTotal:       16318812 kB" into bytes
+func parseMemInfo(r io.Reader) (map[string]uint64, error) {
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			value *= 1024
+		}
+		values[name] = value
+	}
+	return values, scanner.Err()
+}
+
+// Returns times of every CPU in order cpu0..cpuN
+func readCPUTimes(path string) ([]cpuTimes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cpus, err := parseCPUTimes(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cpus, nil
+}
+
+// Parses "cpuN user nice system idle iowait irq softirq steal ..." lines, the aggregated "cpu" line is skipped
+func parseCPUTimes(r io.Reader) ([]cpuTimes, error) {
+	var cpus []cpuTimes
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] == "cpu" || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		var times cpuTimes
+		// guest and guest_nice are already included in user and nice
+		for i, field := range fields[1:min(len(fields), 9)] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			times.total += value
+			if i == 3 || i == 4 { // idle, iowait
+				times.idle += value
+			}
+		}
+		cpus = append(cpus, times)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cpus) == 0 {
+		return nil, errors.New("no cpu lines")
+	}
+	return cpus, nil
+}
+
+// Returns 1, 5 and 15 minutes load averages
+func readLoadAvg(path string) ([3]string, error) {
+	var loads [3]string
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return loads, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return loads, fmt.Errorf("%s: unexpected format", path)
+	}
+	for i := range loads {
+		if _, err := strconv.ParseFloat(fields[i], 64); err != nil {
+			return loads, fmt.Errorf("%s: %w", path, err)
+		}
+		loads[i] = fields[i]
+	}
+	return loads, nil
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMemInfo = `MemTotal:       16318812 kB
+MemFree:         1195576 kB
+MemAvailable:    9146348 kB
+HugePages_Total:       0
+`
+
+const testLoadAvg = "0.52 0.58 0.59 1/1017 12345\n"
+
+func writeProcFile(t *testing.T, dir, name, content string) {
+	err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	require.NoError(t, err)
+}
+
+func readGauge(t *testing.T, c *collector, name string) string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	m, ok := c.stats[name]
+	require.True(t, ok, name)
+	_, _, value := m.GetParams()
+	return value
+}
+
+func TestSystemSource(t *testing.T) {
+	dir := t.TempDir()
+	writeProcFile(t, dir, "meminfo", testMemInfo)
+	writeProcFile(t, dir, "loadavg", testLoadAvg)
+	writeProcFile(t, dir, "stat", "cpu  200 0 100 700 0 0 0 0 0 0\n"+
+		"cpu0 100 0 50 350 0 0 0 0 0 0\n"+
+		"cpu1 100 0 50 350 0 0 0 0 0 0\n"+
+		"intr 1 2 3\n")
+
+	c := NewCollector(log.New(io.Discard, "", 0), nil)
+	c.AddSource(NewSystemSource(dir), 0)
+
+	require.NoError(t, c.CollectMetrics())
+	assert.Equal(t, "16710463488", readGauge(t, c, "TotalMemory"))
+	assert.Equal(t, "1224269824", readGauge(t, c, "FreeMemory"))
+	assert.Equal(t, "0.52", readGauge(t, c, "LoadAverage1"))
+	assert.Equal(t, "0.58", readGauge(t, c, "LoadAverage5"))
+	assert.Equal(t, "0.59", readGauge(t, c, "LoadAverage15"))
+	// first sample is the average since boot
+	assert.Equal(t, "30.00", readGauge(t, c, "CPUutilization1"))
+
+	// cpu0 was busy half of the time, cpu1 was idle
+	writeProcFile(t, dir, "stat", "cpu  300 0 100 800 0 0 0 0 0 0\n"+
+		"cpu0 150 0 50 400 0 0 0 0 0 0\n"+
+		"cpu1 100 0 50 400 50 0 0 0 0 0\n")
+
+	require.NoError(t, c.CollectMetrics())
+	assert.Equal(t, "50.00", readGauge(t, c, "CPUutilization1"))
+	assert.Equal(t, "0.00", readGauge(t, c, "CPUutilization2"))
+}
+
+func TestSystemSourceErrors(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCollector(log.New(io.Discard, "", 0), nil)
+	c.AddSource(NewSystemSource(dir), 0)
+
+	err := c.CollectMetrics()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	writeProcFile(t, dir, "meminfo", "MemTotal: lots kB\n")
+	assert.Error(t, c.CollectMetrics())
+}
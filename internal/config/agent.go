@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Agent transports
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+type AgentConfig struct {
+	Address        string        `json:"address" yaml:"address"`
+	PollInterval   Duration      `json:"poll_interval" yaml:"poll_interval"`
+	ReportInterval Duration      `json:"report_interval" yaml:"report_interval"`
+	Gzip           bool          `json:"gzip" yaml:"gzip"`
+	Key            string        `json:"key" yaml:"key"`
+	CryptoKey      string        `json:"crypto_key" yaml:"crypto_key"`
+	Retries        int           `json:"retries" yaml:"retries"`
+	RetryBackoff   Duration      `json:"retry_backoff" yaml:"retry_backoff"`
+	BufferSize     int           `json:"buffer_size" yaml:"buffer_size"`
+	SystemMetrics  bool          `json:"system_metrics" yaml:"system_metrics"`
+	Workers        int           `json:"workers" yaml:"workers"`
+	RateLimit      int           `json:"rate_limit" yaml:"rate_limit"`
+	Labels         metric.Labels `json:"labels" yaml:"labels"` // attached to every sent metric
+	PauseBuckets   Buckets       `json:"pause_buckets" yaml:"pause_buckets"`
+	RuntimeMetrics []string      `json:"runtime_metrics" yaml:"runtime_metrics"` // runtime/metrics names
+	// Collection intervals of sources by source name, other sources are collected every PollInterval
+	SourceIntervals map[string]Duration `json:"source_intervals" yaml:"source_intervals"`
+	Transport       string              `json:"transport" yaml:"transport"` // http or grpc
+	GRPCAddress     string              `json:"grpc_address" yaml:"grpc_address"`
+	GRPCStream      bool                `json:"grpc_stream" yaml:"grpc_stream"` // send snapshots with StreamMetrics
+	ConfigFile      string              `json:"-" yaml:"-"`
+}
+
+func DefaultAgentConfig() *AgentConfig {
+	return &AgentConfig{
+		Address:        "localhost:8080",
+		PollInterval:   Duration{2 * time.Second},
+		ReportInterval: Duration{10 * time.Second},
+		Gzip:           true,
+		Retries:        3,
+		RetryBackoff:   Duration{time.Second},
+		BufferSize:     100,
+		SystemMetrics:  true,
+		Workers:        2,
+		RateLimit:      2,
+		// GC pauses in nanoseconds: 10µs .. 100ms
+		PauseBuckets: Buckets{1e4, 5e4, 1e5, 5e5, 1e6, 5e6, 1e7, 5e7, 1e8},
+		Transport:    TransportHTTP,
+		GRPCAddress:  "localhost:3200",
+	}
+}
+
+// Loads agent config. Priority from lowest to highest: defaults, config file, flags, environment.
+func LoadAgentConfig(args []string) (*AgentConfig, error) {
+	cfg := DefaultAgentConfig()
+
+	// first pass only finds out the config file
+	probe := *cfg
+	if err := agentFlags(&probe).Parse(args); err != nil {
+		return nil, err
+	}
+	path := probe.ConfigFile
+	if env, ok := os.LookupEnv("CONFIG"); ok {
+		path = env
+	}
+	if path != "" {
+		if err := LoadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := agentFlags(cfg).Parse(args); err != nil {
+		return nil, err
+	}
+
+	err := loadEnv(map[string]func(string) error{
+		"ADDRESS":          setString(&cfg.Address),
+		"POLL_INTERVAL":    setDuration(&cfg.PollInterval),
+		"REPORT_INTERVAL":  setDuration(&cfg.ReportInterval),
+		"GZIP":             setBool(&cfg.Gzip),
+		"KEY":              setString(&cfg.Key),
+		"CRYPTO_KEY":       setString(&cfg.CryptoKey),
+		"RETRIES":          setInt(&cfg.Retries),
+		"RETRY_BACKOFF":    setDuration(&cfg.RetryBackoff),
+		"BUFFER_SIZE":      setInt(&cfg.BufferSize),
+		"SYSTEM_METRICS":   setBool(&cfg.SystemMetrics),
+		"WORKERS":          setInt(&cfg.Workers),
+		"RATE_LIMIT":       setInt(&cfg.RateLimit),
+		"LABELS":           setLabels(&cfg.Labels),
+		"PAUSE_BUCKETS":    cfg.PauseBuckets.Set,
+		"RUNTIME_METRICS":  setList(&cfg.RuntimeMetrics),
+		"SOURCE_INTERVALS": setIntervals(&cfg.SourceIntervals),
+		"TRANSPORT":        setString(&cfg.Transport),
+		"GRPC_ADDRESS":     setString(&cfg.GRPCAddress),
+		"GRPC_STREAM":      setBool(&cfg.GRPCStream),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (cfg *AgentConfig) Validate() error {
+	if _, _, err := SplitAddress(cfg.Address); err != nil {
+		return err
+	}
+	switch cfg.Transport {
+	case TransportHTTP:
+	case TransportGRPC:
+		if _, _, err := SplitAddress(cfg.GRPCAddress); err != nil {
+			return err
+		}
+		// grpc идет без TLS, молча отправлять открытым текстом то, что должно быть зашифровано, нельзя
+		if cfg.CryptoKey != "" {
+			return errors.New("crypto key is not supported with grpc transport")
+		}
+	default:
+		return fmt.Errorf("unknown transport %q, want %s or %s", cfg.Transport, TransportHTTP, TransportGRPC)
+	}
+	if cfg.PollInterval.Duration <= 0 {
+		return errors.New("poll interval must be positive")
+	}
+	if cfg.ReportInterval.Duration <= 0 {
+		return errors.New("report interval must be positive")
+	}
+	if cfg.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+	if cfg.RetryBackoff.Duration < 0 {
+		return errors.New("retry backoff must not be negative")
+	}
+	if cfg.BufferSize < 1 {
+		return errors.New("buffer size must be positive")
+	}
+	if cfg.Workers < 1 {
+		return errors.New("number of workers must be positive")
+	}
+	if cfg.RateLimit < 1 {
+		return errors.New("rate limit must be positive")
+	}
+	for name, interval := range cfg.SourceIntervals {
+		if interval.Duration <= 0 {
+			return fmt.Errorf("interval of source %s must be positive", name)
+		}
+	}
+	if len(cfg.PauseBuckets) > 0 {
+		if _, err := metric.NewHistogramValue(cfg.PauseBuckets); err != nil {
+			return fmt.Errorf("pause buckets: %w", err)
+		}
+	}
+	return cfg.Labels.Validate()
+}
+
+func agentFlags(cfg *AgentConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "server address in the host:port format")
+	fs.Var(&cfg.PollInterval, "p", "interval of collecting metrics")
+	fs.Var(&cfg.ReportInterval, "r", "interval of sending metrics to the server")
+	fs.BoolVar(&cfg.Gzip, "gzip", cfg.Gzip, "compress requests with gzip")
+	fs.StringVar(&cfg.Key, "k", cfg.Key, "key for HMAC-SHA256 signing of requests")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "server RSA public key in PEM, enables encryption of requests")
+	fs.IntVar(&cfg.Retries, "retries", cfg.Retries, "how many times to repeat request when the server is unavailable")
+	fs.Var(&cfg.RetryBackoff, "retry-backoff", "delay before the first retry, doubled for every next one")
+	fs.IntVar(&cfg.BufferSize, "buffer-size", cfg.BufferSize, "how many unsent snapshots to keep while the server is unavailable")
+	fs.BoolVar(&cfg.SystemMetrics, "system-metrics", cfg.SystemMetrics, "collect host memory, CPU and load metrics from /proc")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "number of goroutines sending metrics")
+	fs.IntVar(&cfg.RateLimit, "l", cfg.RateLimit, "maximum number of concurrent requests to the server")
+	fs.Func("labels", "labels attached to every metric in the name=value,name2=value2 format", setLabels(&cfg.Labels))
+	fs.Var(&cfg.PauseBuckets, "pause-buckets", "comma separated upper bounds of GC pause histogram buckets in nanoseconds, empty disables it")
+	fs.Func("runtime-metrics", "comma separated runtime/metrics names to collect, e.g. /sched/goroutines:goroutines", setList(&cfg.RuntimeMetrics))
+	fs.Func("source-intervals", "collection intervals of sources in the name=duration format, e.g. system=10s,runtime=1s", setIntervals(&cfg.SourceIntervals))
+	fs.StringVar(&cfg.Transport, "transport", cfg.Transport, "how to send metrics: http or grpc")
+	fs.StringVar(&cfg.GRPCAddress, "grpc-address", cfg.GRPCAddress, "server gRPC address in the host:port format")
+	fs.BoolVar(&cfg.GRPCStream, "grpc-stream", cfg.GRPCStream, "send snapshots as a stream of metrics instead of one batch")
+	fs.StringVar(&cfg.ConfigFile, "c", cfg.ConfigFile, "JSON or YAML config file")
+	fs.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "JSON or YAML config file")
+	return fs
+}
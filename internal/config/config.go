@@ -0,0 +1,210 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is time.Duration that can be set from flags, environment and config files.
+// Plain numbers are treated as seconds, e.g. "10" == "10s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		d.Duration = time.Duration(seconds) * time.Second
+		return nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: use seconds or Go duration like 10s", value)
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) String() string {
+	return d.Duration.String()
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return d.Set(fmt.Sprint(value))
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.Set(node.Value)
+}
+
+// Buckets are upper bounds of histogram buckets, set from a comma separated list like "0.1,0.5,1".
+// Empty list disables the histogram.
+type Buckets []float64
+
+func (b *Buckets) Set(value string) error {
+	var bounds Buckets
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		bound, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return fmt.Errorf("invalid bucket bound %q", field)
+		}
+		bounds = append(bounds, bound)
+	}
+	*b = bounds
+	return nil
+}
+
+func (b Buckets) String() string {
+	fields := make([]string, len(b))
+	for i, bound := range b {
+		fields[i] = strconv.FormatFloat(bound, 'g', -1, 64)
+	}
+	return strings.Join(fields, ",")
+}
+
+// Splits address in the host:port format
+func SplitAddress(address string) (string, string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid address %q, want host:port: %w", address, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", fmt.Errorf("invalid port in address %q", address)
+	}
+	return host, port, nil
+}
+
+// Reads config file into cfg. Format is chosen by extension: .yaml/.yml or JSON otherwise.
+// Fields missing in the file keep their values.
+func LoadFile(path string, cfg any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Applies environment variables to config fields. Values are parsed by setters.
+func loadEnv(setters map[string]func(string) error) error {
+	for name, set := range setters {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := set(value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setString(dst *string) func(string) error {
+	return func(value string) error {
+		*dst = value
+		return nil
+	}
+}
+
+func setDuration(dst *Duration) func(string) error {
+	return dst.Set
+}
+
+func setInt(dst *int) func(string) error {
+	return func(value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*dst = i
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*dst = b
+		return nil
+	}
+}
+
+// Parses labels in the name=value,name2=value2 format
+func setLabels(dst *metric.Labels) func(string) error {
+	return func(value string) error {
+		labels, err := metric.ParseLabels(value)
+		if err != nil {
+			return err
+		}
+		*dst = labels
+		return nil
+	}
+}
+
+// Splits comma separated list, empty items are skipped
+func setList(dst *[]string) func(string) error {
+	return func(value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*dst = list
+		return nil
+	}
+}
+
+// Parses intervals in the name=duration,name2=duration2 format, durations as in Duration
+func setIntervals(dst *map[string]Duration) func(string) error {
+	return func(value string) error {
+		intervals := make(map[string]Duration)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			name, interval, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid interval %q, want name=duration", item)
+			}
+			var d Duration
+			if err := d.Set(interval); err != nil {
+				return err
+			}
+			intervals[strings.TrimSpace(name)] = d
+		}
+		*dst = intervals
+		return nil
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServerConfig_Priority(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	err := os.WriteFile(path, []byte(`{"address":"file:1","store_interval":"1m","store_file":"/file.json","restore":false}`), 0644)
+	require.NoError(t, err)
+
+	// file overrides defaults
+	cfg, err := LoadServerConfig([]string{"-c", path})
+	require.NoError(t, err)
+	assert.Equal(t, "file:1", cfg.Address)
+	assert.Equal(t, time.Minute, cfg.StoreInterval.Duration)
+	assert.Equal(t, "/file.json", cfg.FileStoragePath)
+	assert.False(t, cfg.Restore)
+
+	// flags override file, environment overrides flags
+	t.Setenv("ADDRESS", "env:3")
+	cfg, err = LoadServerConfig([]string{"-config=" + path, "-a", "flag:2", "-i", "0", "-r"})
+	require.NoError(t, err)
+	assert.Equal(t, "env:3", cfg.Address)
+	assert.Equal(t, time.Duration(0), cfg.StoreInterval.Duration)
+	assert.Equal(t, "/file.json", cfg.FileStoragePath)
+	assert.True(t, cfg.Restore)
+}
+
+func TestLoadAgentConfig_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	err := os.WriteFile(path, []byte("address: example.com:9090\npoll_interval: 5\nreport_interval: 500ms\nlabels:\n  env: prod\n"), 0644)
+	require.NoError(t, err)
+	t.Setenv("CONFIG", path)
+	t.Setenv("POLL_INTERVAL", "3")
+
+	cfg, err := LoadAgentConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:9090", cfg.Address)
+	assert.Equal(t, 3*time.Second, cfg.PollInterval.Duration)
+	assert.Equal(t, 500*time.Millisecond, cfg.ReportInterval.Duration)
+	assert.Equal(t, metric.Labels{"env": "prod"}, cfg.Labels)
+
+	t.Setenv("RUNTIME_METRICS", "/sched/goroutines:goroutines, /gc/pauses:seconds")
+	t.Setenv("LABELS", "host=web-1, env=dev")
+	cfg, err = LoadAgentConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, metric.Labels{"host": "web-1", "env": "dev"}, cfg.Labels)
+	assert.Equal(t, []string{"/sched/goroutines:goroutines", "/gc/pauses:seconds"}, cfg.RuntimeMetrics)
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{"bad address", []string{"-a", "localhost"}, nil},
+		{"bad port", []string{"-a", "localhost:port"}, nil},
+		{"bad interval flag", []string{"-r", "often"}, nil},
+		{"zero interval", []string{"-p", "0"}, nil},
+		{"bad interval env", nil, map[string]string{"REPORT_INTERVAL": "-"}},
+		{"missing config file", []string{"-c", "/nonexistent.json"}, nil},
+		{"bad label name", []string{"-labels", "1host=web"}, nil},
+		{"label without value", nil, map[string]string{"LABELS": "host"}},
+		{"unknown transport", []string{"-transport", "udp"}, nil},
+		{"bad grpc address", nil, map[string]string{"TRANSPORT": "grpc", "GRPC_ADDRESS": "localhost"}},
+		{"encryption over grpc", []string{"-transport", "grpc", "-crypto-key", "public.pem"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := LoadAgentConfig(tt.args)
+			assert.Error(t, err)
+		})
+	}
+}
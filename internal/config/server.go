@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"time"
+)
+
+type ServerConfig struct {
+	Address         string   `json:"address" yaml:"address"`
+	StoreInterval   Duration `json:"store_interval" yaml:"store_interval"`
+	FileStoragePath string   `json:"store_file" yaml:"store_file"`
+	Restore         bool     `json:"restore" yaml:"restore"`
+	DatabaseDSN     string   `json:"database_dsn" yaml:"database_dsn"`
+	Key             string   `json:"key" yaml:"key"`
+	CryptoKey       string   `json:"crypto_key" yaml:"crypto_key"`
+	HistorySize     int      `json:"history_size" yaml:"history_size"`
+	HistoryAge      Duration `json:"history_age" yaml:"history_age"`
+	AlertRules      string   `json:"alert_rules" yaml:"alert_rules"`
+	AlertInterval   Duration `json:"alert_interval" yaml:"alert_interval"`
+	StatsdAddress   string   `json:"statsd_address" yaml:"statsd_address"`
+	StatsdFlush     Duration `json:"statsd_flush" yaml:"statsd_flush"`
+	InfluxCounters  []string `json:"influx_counter_suffixes" yaml:"influx_counter_suffixes"`
+	InfluxUnsigned  bool     `json:"influx_unsigned" yaml:"influx_unsigned"`
+	GraphiteAddress string   `json:"graphite_address" yaml:"graphite_address"`
+	GRPCAddress     string   `json:"grpc_address" yaml:"grpc_address"`
+	ConfigFile      string   `json:"-" yaml:"-"`
+}
+
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Address:         "localhost:8080",
+		StoreInterval:   Duration{300 * time.Second},
+		FileStoragePath: "/tmp/metrics-db.json",
+		Restore:         true,
+		HistorySize:     1000,
+		HistoryAge:      Duration{time.Hour},
+		AlertInterval:   Duration{10 * time.Second},
+		StatsdFlush:     Duration{10 * time.Second},
+		InfluxCounters:  []string{"_total"},
+	}
+}
+
+// Loads server config. Priority from lowest to highest: defaults, config file, flags, environment.
+func LoadServerConfig(args []string) (*ServerConfig, error) {
+	cfg := DefaultServerConfig()
+
+	// first pass only finds out the config file
+	probe := *cfg
+	if err := serverFlags(&probe).Parse(args); err != nil {
+		return nil, err
+	}
+	path := probe.ConfigFile
+	if env, ok := os.LookupEnv("CONFIG"); ok {
+		path = env
+	}
+	if path != "" {
+		if err := LoadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := serverFlags(cfg).Parse(args); err != nil {
+		return nil, err
+	}
+
+	err := loadEnv(map[string]func(string) error{
+		"ADDRESS":                 setString(&cfg.Address),
+		"STORE_INTERVAL":          setDuration(&cfg.StoreInterval),
+		"FILE_STORAGE_PATH":       setString(&cfg.FileStoragePath),
+		"RESTORE":                 setBool(&cfg.Restore),
+		"DATABASE_DSN":            setString(&cfg.DatabaseDSN),
+		"KEY":                     setString(&cfg.Key),
+		"CRYPTO_KEY":              setString(&cfg.CryptoKey),
+		"HISTORY_SIZE":            setInt(&cfg.HistorySize),
+		"HISTORY_AGE":             setDuration(&cfg.HistoryAge),
+		"ALERT_RULES":             setString(&cfg.AlertRules),
+		"ALERT_INTERVAL":          setDuration(&cfg.AlertInterval),
+		"STATSD_ADDRESS":          setString(&cfg.StatsdAddress),
+		"STATSD_FLUSH":            setDuration(&cfg.StatsdFlush),
+		"INFLUX_COUNTER_SUFFIXES": setList(&cfg.InfluxCounters),
+		"INFLUX_UNSIGNED":         setBool(&cfg.InfluxUnsigned),
+		"GRAPHITE_ADDRESS":        setString(&cfg.GraphiteAddress),
+		"GRPC_ADDRESS":            setString(&cfg.GRPCAddress),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (cfg *ServerConfig) Validate() error {
+	if _, _, err := SplitAddress(cfg.Address); err != nil {
+		return err
+	}
+	if cfg.StoreInterval.Duration < 0 {
+		return errors.New("store interval must not be negative")
+	}
+	if cfg.HistorySize < 0 {
+		return errors.New("history size must not be negative")
+	}
+	if cfg.HistoryAge.Duration < 0 {
+		return errors.New("history age must not be negative")
+	}
+	if cfg.AlertRules != "" && cfg.AlertInterval.Duration <= 0 {
+		return errors.New("alert interval must be positive")
+	}
+	if cfg.StatsdAddress != "" {
+		if _, _, err := SplitAddress(cfg.StatsdAddress); err != nil {
+			return err
+		}
+		if cfg.StatsdFlush.Duration <= 0 {
+			return errors.New("statsd flush interval must be positive")
+		}
+	}
+	if cfg.GraphiteAddress != "" {
+		if _, _, err := SplitAddress(cfg.GraphiteAddress); err != nil {
+			return err
+		}
+	}
+	if cfg.GRPCAddress != "" {
+		if _, _, err := SplitAddress(cfg.GRPCAddress); err != nil {
+			return err
+		}
+	}
+	if cfg.DatabaseDSN == "" && cfg.FileStoragePath == "" {
+		return errors.New("either database DSN or file storage path must be set")
+	}
+	return nil
+}
+
+func serverFlags(cfg *ServerConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "address to listen on in the host:port format")
+	fs.Var(&cfg.StoreInterval, "i", "interval of saving metrics to the file, 0 saves on every update")
+	fs.StringVar(&cfg.FileStoragePath, "f", cfg.FileStoragePath, "file to save metrics to")
+	fs.BoolVar(&cfg.Restore, "r", cfg.Restore, "restore metrics from the file on start")
+	fs.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "PostgreSQL DSN, enables database storage")
+	fs.StringVar(&cfg.Key, "k", cfg.Key, "key for HMAC-SHA256 verification of requests and signing of responses")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "RSA private key in PEM for decryption of requests")
+	fs.IntVar(&cfg.HistorySize, "history-size", cfg.HistorySize, "samples of history kept per metric, 0 disables history")
+	fs.Var(&cfg.HistoryAge, "history-age", "how long history samples are kept, 0 keeps them until pushed out by newer ones")
+	fs.StringVar(&cfg.AlertRules, "alert-rules", cfg.AlertRules, "JSON or YAML file with alerting rules, enables alerting")
+	fs.Var(&cfg.AlertInterval, "alert-interval", "interval of alerting rules evaluation")
+	fs.StringVar(&cfg.StatsdAddress, "statsd-address", cfg.StatsdAddress, "host:port to accept StatsD metrics on over UDP and TCP, disabled if empty")
+	fs.Var(&cfg.StatsdFlush, "statsd-flush", "interval of writing aggregated StatsD metrics to storage")
+	fs.Func("influx-counter-suffixes", "comma separated suffixes of InfluxDB field names that are counters, default _total", setList(&cfg.InfluxCounters))
+	fs.BoolVar(&cfg.InfluxUnsigned, "influx-unsigned", cfg.InfluxUnsigned, "accept InfluxDB writes without HashSHA256 even when the key is set")
+	fs.StringVar(&cfg.GraphiteAddress, "graphite-address", cfg.GraphiteAddress, "host:port to accept Graphite plaintext metrics on over TCP, disabled if empty")
+	fs.StringVar(&cfg.GRPCAddress, "grpc-address", cfg.GRPCAddress, "host:port to serve gRPC on, disabled if empty")
+	fs.StringVar(&cfg.ConfigFile, "c", cfg.ConfigFile, "JSON or YAML config file")
+	fs.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "JSON or YAML config file")
+	return fs
+}
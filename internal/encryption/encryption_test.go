@@ -0,0 +1,63 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, blockType string, data []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	privBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	pub, err := LoadPublicKey(writePEM(t, "PUBLIC KEY", pubBytes))
+	require.NoError(t, err)
+	priv, err := LoadPrivateKey(writePEM(t, "PRIVATE KEY", privBytes))
+	require.NoError(t, err)
+
+	// much larger than RSA could encrypt directly
+	data := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 1000)
+
+	encrypted, err := Encrypt(pub, data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "Alloc")
+
+	decrypted, err := Decrypt(priv, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+
+	encrypted[len(encrypted)-1] ^= 1
+	_, err = Decrypt(priv, encrypted)
+	assert.Error(t, err)
+
+	_, err = Decrypt(priv, []byte{0xff})
+	assert.Error(t, err)
+}
+
+func TestLoadKey_Errors(t *testing.T) {
+	_, err := LoadPublicKey(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+
+	_, err = LoadPrivateKey(writePEM(t, "PRIVATE KEY", []byte("garbage")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+// Package graphite accepts metrics in Graphite plaintext protocol:
+//
+//	path.to.metric[;tag=value...] value timestamp
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bazookajoe1/metrics-collector/internal/lineserver"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Storage the metrics are written to
+type Storage interface {
+	UpdateMetrics([]*metric.Metric) error
+}
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_:]`)
+
+// listener accepts Graphite plaintext lines over TCP and stores every value as a gauge.
+// Dots of the path become underscores, so servers.web1.cpu is stored as servers_web1_cpu.
+// Graphite tags (path;tag=value) become labels. Timestamps are ignored, values are stored
+// with the time they are received. Lines received by one read are stored in one batch.
+type listener struct {
+	Address string
+	Strg    Storage
+	Logger  *log.Logger
+
+	tcp net.Listener
+}
+
+func NewListener(address string, storage Storage, logger *log.Logger) *listener {
+	return &listener{
+		Address: address,
+		Strg:    storage,
+		Logger:  logger,
+	}
+}
+
+// Binds TCP socket to Address
+func (l *listener) Listen() error {
+	var err error
+	l.tcp, err = net.Listen("tcp", l.Address)
+	if err != nil {
+		return err
+	}
+	l.Address = l.tcp.Addr().String()
+	return nil
+}
+
+// Accepts connections on the socket bound by Listen until ctx is done,
+// then closes open connections and waits for their lines to be stored
+func (l *listener) Serve(ctx context.Context) {
+	l.Logger.Printf("graphite listening on %s", l.Address)
+	lineserver.ServeBatches(ctx, l.tcp, "graphite", l.handleLines, l.Logger)
+}
+
+// Parses lines and stores them with one write, invalid lines are logged and dropped
+func (l *listener) handleLines(lines []string) {
+	metrics := make([]*metric.Metric, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m, err := parseLine(line)
+		if err != nil {
+			l.Logger.Println("graphite:", err)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	if len(metrics) == 0 {
+		return
+	}
+	if err := l.Strg.UpdateMetrics(metrics); err != nil {
+		l.Logger.Println("graphite:", err)
+	}
+}
+
+// Parses line into gauge: path value timestamp
+func parseLine(line string) (*metric.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid line %q: want path value timestamp", line)
+	}
+
+	path, tags, _ := strings.Cut(fields[0], ";")
+	name := metricName(path)
+	if name == "" {
+		return nil, fmt.Errorf("invalid line %q: path is empty", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("invalid value %q", fields[1])
+	}
+	// -1 означает текущее время
+	if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q", fields[2])
+	}
+
+	labels, err := parseTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := metric.NewMetric(name, metric.Gauge, strconv.FormatFloat(value, 'f', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+	return m, m.SetLabels(labels)
+}
+
+// Translates dotted path to metric name
+func metricName(path string) string {
+	return invalidNameChars.ReplaceAllString(strings.Trim(path, "."), "_")
+}
+
+// Parses tags in the form tag=value;tag2=value2
+func parseTags(s string) (metric.Labels, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(metric.Labels)
+	for _, tag := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("invalid tag %q: want tag=value", tag)
+		}
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("tag %s is duplicated", name)
+		}
+		labels[name] = value
+	}
+	return labels, labels.Validate()
+}
@@ -0,0 +1,113 @@
+package graphite
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		value  string
+		labels metric.Labels
+	}{
+		{"servers.web1.cpu 12.5 1700000000", "servers_web1_cpu", "12.5", nil},
+		{"jobs.nightly-import.duration 30 -1", "jobs_nightly_import_duration", "30", nil},
+		{"disk.used;host=a;mount=data 1e3 1700000000", "disk_used", "1000", metric.Labels{"host": "a", "mount": "data"}},
+	}
+	for _, tt := range tests {
+		m, err := parseLine(tt.line)
+		require.NoError(t, err, tt.line)
+		name, mType, value := m.GetParams()
+		assert.Equal(t, tt.name, name, tt.line)
+		assert.Equal(t, metric.Gauge, mType, tt.line)
+		assert.Equal(t, tt.value, value, tt.line)
+		assert.Equal(t, tt.labels, m.Labels(), tt.line)
+	}
+
+	for _, line := range []string{
+		"servers.web1.cpu 12.5",
+		"servers.web1.cpu abc 1700000000",
+		"servers.web1.cpu 1 now",
+		"servers.web1.cpu;host 1 1700000000",
+		"servers.web1.cpu;bad-tag=1 1 1700000000",
+		". 1 1700000000",
+	} {
+		_, err := parseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestListener(t *testing.T) {
+	strg := memstorage.NewInMemoryStorage()
+	l := NewListener("127.0.0.1:0", strg, log.New(io.Discard, "", 0))
+	require.NoError(t, l.Listen())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(ctx)
+	}()
+
+	conn, err := net.Dial("tcp", l.Address)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("jobs.backup.size 42 1700000000\nbroken\njobs.backup.files;host=a 7 1700000000\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	require.Eventually(t, func() bool {
+		_, err := strg.ReadMetric(metric.Gauge, "jobs_backup_files", metric.Labels{"host": "a"})
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	value, err := strg.ReadMetric(metric.Gauge, "jobs_backup_size", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "42", value)
+}
+
+type readStorage interface {
+	Storage
+	ReadMetric(mType string, mName string, labels metric.Labels) (string, error)
+}
+
+// Counts batch writes
+type countingStorage struct {
+	readStorage
+	mu      sync.Mutex
+	batches [][]*metric.Metric
+}
+
+func (s *countingStorage) UpdateMetrics(metrics []*metric.Metric) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, metrics)
+	s.mu.Unlock()
+	return s.readStorage.UpdateMetrics(metrics)
+}
+
+func TestListener_HandleLines(t *testing.T) {
+	strg := &countingStorage{readStorage: memstorage.NewInMemoryStorage()}
+	l := NewListener("127.0.0.1:0", strg, log.New(io.Discard, "", 0))
+
+	l.handleLines([]string{"a.b 1 -1", "", "broken", "a.c 2 -1", "a.b 3 -1"})
+	l.handleLines([]string{"broken"})
+
+	require.Len(t, strg.batches, 1, "lines are stored with one write, nothing is written without valid lines")
+	assert.Len(t, strg.batches[0], 3)
+	value, err := strg.ReadMetric(metric.Gauge, "a_b", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+}
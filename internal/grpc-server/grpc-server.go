@@ -0,0 +1,217 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/bazookajoe1/metrics-collector/internal/hashing"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	pb "github.com/bazookajoe1/metrics-collector/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // клиенты могут сжимать запросы
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type Storage interface {
+	UpdateMetric(*metric.Metric) error
+	UpdateMetrics([]*metric.Metric) error
+	ReadMetric(mType string, mName string, labels metric.Labels) (string, error)
+	ListMetrics() ([]*metric.Metric, error)
+}
+
+// Metadata key of the request hash, gRPC keeps metadata keys in lower case
+var hashMetadataKey = strings.ToLower(hashing.Header)
+
+// _GRPCServer serves the Metrics service over the same storage as the HTTP server
+type _GRPCServer struct {
+	pb.UnimplementedMetricsServer
+
+	Address string
+	Strg    Storage
+	Key     string // HMAC key, requests must be signed when set
+	Logger  *log.Logger
+
+	onStreamRecv func(received int) // called after every message of StreamMetrics, used in tests
+}
+
+func ServerNew(address string, storage Storage, logger *log.Logger) *_GRPCServer {
+	return &_GRPCServer{
+		Address: address,
+		Strg:    storage,
+		Logger:  logger,
+	}
+}
+
+// Serves on the listener until ctx is done
+func (serv *_GRPCServer) Serve(ctx context.Context, listener net.Listener) error {
+	server := grpc.NewServer(grpc.UnaryInterceptor(serv.hashInterceptor))
+	pb.RegisterMetricsServer(server, serv)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(listener)
+	}()
+	serv.Logger.Printf("grpc listening on %s", listener.Addr())
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	serv.Logger.Println("shutting down grpc server")
+	server.GracefulStop()
+	return nil
+}
+
+// Verifies HashSHA256 metadata of unary requests. Does nothing when the key is not set.
+func (serv *_GRPCServer) hashInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if serv.Key == "" {
+		return handler(ctx, req)
+	}
+
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, status.Error(codes.Internal, "request is not a protobuf message")
+	}
+	var sign string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(hashMetadataKey); len(values) > 0 {
+			sign = values[0]
+		}
+	}
+	if !pb.Verify(msg, serv.Key, sign) {
+		serv.Logger.Println("hash mismatch", info.FullMethod)
+		return nil, status.Error(codes.Unauthenticated, "hash mismatch")
+	}
+	return handler(ctx, req)
+}
+
+func (serv *_GRPCServer) UpdateMetric(ctx context.Context, req *pb.UpdateMetricRequest) (*pb.UpdateMetricResponse, error) {
+	m, err := req.GetMetric().ToMetric()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := serv.Strg.UpdateMetric(m); err != nil {
+		serv.Logger.Println(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// в ответе значение после обновления, как в /update/
+	mName, mType, _ := m.GetParams()
+	current, err := serv.readMetric(mType, mName, m.Labels())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateMetricResponse{Metric: current}, nil
+}
+
+func (serv *_GRPCServer) UpdateMetrics(ctx context.Context, req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	metrics := make([]*metric.Metric, 0, len(req.GetMetrics()))
+	for _, pm := range req.GetMetrics() {
+		m, err := pm.ToMetric()
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		metrics = append(metrics, m)
+	}
+
+	if err := serv.Strg.UpdateMetrics(metrics); err != nil {
+		serv.Logger.Println(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.UpdateMetricsResponse{}, nil
+}
+
+// Collects the whole stream and stores it at once like UpdateMetrics, so a stream broken midway
+// changes nothing and the client may safely send it again
+func (serv *_GRPCServer) StreamMetrics(stream pb.Metrics_StreamMetricsServer) error {
+	var metrics []*metric.Metric
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if serv.Key != "" && !pb.Verify(req.GetMetric(), serv.Key, req.GetHash()) {
+			serv.Logger.Println("hash mismatch in stream")
+			return status.Error(codes.Unauthenticated, "hash mismatch")
+		}
+		m, err := req.GetMetric().ToMetric()
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		metrics = append(metrics, m)
+		if serv.onStreamRecv != nil {
+			serv.onStreamRecv(len(metrics))
+		}
+	}
+
+	if len(metrics) > 0 {
+		if err := serv.Strg.UpdateMetrics(metrics); err != nil {
+			serv.Logger.Println(err)
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+	return stream.SendAndClose(&pb.StreamMetricsResponse{Received: int64(len(metrics))})
+}
+
+func (serv *_GRPCServer) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	mType := req.GetType().MetricType()
+	if mType == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid metric type %v", req.GetType())
+	}
+	pm, err := serv.readMetric(mType, req.GetId(), req.GetLabels())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetMetricResponse{Metric: pm}, nil
+}
+
+func (serv *_GRPCServer) ListMetrics(ctx context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	metrics, err := serv.Strg.ListMetrics()
+	if err != nil {
+		serv.Logger.Println(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.ListMetricsResponse{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for _, m := range metrics {
+		pm, err := pb.FromMetric(m)
+		if err != nil {
+			serv.Logger.Println(err)
+			continue
+		}
+		resp.Metrics = append(resp.Metrics, pm)
+	}
+	return resp, nil
+}
+
+func (serv *_GRPCServer) readMetric(mType, mName string, labels metric.Labels) (*pb.Metric, error) {
+	value, err := serv.Strg.ReadMetric(mType, mName, labels)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	m, err := metric.NewMetric(mName, mType, value)
+	if err == nil {
+		err = m.SetLabels(labels)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	pm, err := pb.FromMetric(m)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return pm, nil
+}
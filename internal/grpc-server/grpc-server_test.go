@@ -0,0 +1,152 @@
+package grpcserver
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/hashing"
+	pb "github.com/bazookajoe1/metrics-collector/internal/proto"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func startServer(t *testing.T, key string) pb.MetricsClient {
+	serv := ServerNew("127.0.0.1:0", memstorage.NewInMemoryStorage(), log.New(io.Discard, "", 0))
+	serv.Key = key
+
+	listener, err := net.Listen("tcp", serv.Address)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, serv.Serve(ctx, listener))
+	}()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		<-done
+	})
+	return pb.NewMetricsClient(conn)
+}
+
+func TestGRPCServer(t *testing.T) {
+	client := startServer(t, "")
+	ctx := context.Background()
+
+	resp, err := client.UpdateMetric(ctx, &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), resp.GetMetric().GetDelta())
+
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 3},
+		{Id: "Alloc", Type: pb.Metric_GAUGE, Value: 1.5, Labels: map[string]string{"host": "a"}},
+		{Id: "Latency", Type: pb.Metric_HISTOGRAM, Histogram: &pb.Histogram{Bounds: []float64{1}, Counts: []uint64{2, 1}, Sum: 3, Count: 3}},
+	}})
+	require.NoError(t, err)
+
+	stream, err := client.StreamMetrics(ctx)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, stream.Send(&pb.StreamMetricsRequest{Metric: &pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 1}}))
+	}
+	streamResp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), streamResp.GetReceived())
+
+	got, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "PollCount", Type: pb.Metric_COUNTER})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), got.GetMetric().GetDelta())
+
+	got, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: pb.Metric_GAUGE, Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, got.GetMetric().GetValue())
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: pb.Metric_GAUGE})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 3)
+	assert.Equal(t, uint64(3), list.GetMetrics()[2].GetHistogram().GetCount())
+
+	_, err = client.UpdateMetric(ctx, &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "Alloc"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_Hash(t *testing.T) {
+	const key = "secret"
+	client := startServer(t, key)
+	ctx := context.Background()
+
+	req := &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "Alloc", Type: pb.Metric_GAUGE, Value: 1}}
+	_, err := client.UpdateMetric(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	sign, err := pb.Sign(req, key)
+	require.NoError(t, err)
+	signedCtx := metadata.AppendToOutgoingContext(ctx, strings.ToLower(hashing.Header), sign)
+	_, err = client.UpdateMetric(signedCtx, req)
+	require.NoError(t, err)
+
+	stream, err := client.StreamMetrics(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.StreamMetricsRequest{Metric: req.Metric, Hash: "00"}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestStreamMetrics_DroppedConnection(t *testing.T) {
+	strg := memstorage.NewInMemoryStorage()
+	serv := ServerNew("127.0.0.1:0", strg, log.New(io.Discard, "", 0))
+	received := make(chan struct{})
+	serv.onStreamRecv = func(n int) {
+		if n == 3 {
+			close(received)
+		}
+	}
+	listener, err := net.Listen("tcp", serv.Address)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, serv.Serve(ctx, listener))
+	}()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	stream, err := pb.NewMetricsClient(conn).StreamMetrics(context.Background())
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stream.Send(&pb.StreamMetricsRequest{Metric: &pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 1}}))
+	}
+	// соединение рвется до конца потока, когда сервер уже получил отправленное; клиент повторит отправку целиком
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not receive the sent metrics")
+	}
+	require.NoError(t, conn.Close())
+
+	// GracefulStop waits for the stream handler to return
+	cancel()
+	<-done
+
+	_, err = strg.ReadMetric("counter", "PollCount", nil)
+	assert.Error(t, err, "metrics of a broken stream must not be stored")
+}
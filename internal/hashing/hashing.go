@@ -0,0 +1,28 @@
+package hashing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Header carrying HMAC-SHA256 of the body
+const Header = "HashSHA256"
+
+// Returns hex encoded HMAC-SHA256 of data
+func Sign(data []byte, key string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Checks hex encoded sign is HMAC-SHA256 of data
+func Verify(data []byte, key string, sign string) bool {
+	expected, err := hex.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hmac.Equal(h.Sum(nil), expected)
+}
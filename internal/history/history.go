@@ -0,0 +1,92 @@
+package history
+
+import (
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Default retention of the metric history
+const (
+	DefaultSize   = 1000
+	DefaultMaxAge = time.Hour
+)
+
+// Ring keeps the last samples of one metric. Samples are dropped when there are more than size of them
+// or when they are older than maxAge. Zero maxAge means samples don't expire.
+// Memory is allocated as samples are added, up to size of them.
+// Ring is not safe for concurrent use.
+type Ring struct {
+	samples []metric.Sample
+	size    int
+	start   int // index of the oldest sample
+	count   int
+	maxAge  time.Duration
+}
+
+func NewRing(size int, maxAge time.Duration) *Ring {
+	return &Ring{size: size, maxAge: maxAge}
+}
+
+// Adds sample, samples must be added in chronological order
+func (r *Ring) Add(sample metric.Sample) {
+	if r.size <= 0 {
+		return
+	}
+
+	if r.count == len(r.samples) && len(r.samples) < r.size {
+		// места нет, но кольцо еще может расти: выпрямляем его и дописываем в конец
+		if r.start != 0 {
+			grown := make([]metric.Sample, 0, len(r.samples)+1)
+			grown = append(grown, r.samples[r.start:]...)
+			r.samples = append(grown, r.samples[:r.start]...)
+			r.start = 0
+		}
+		r.samples = append(r.samples, sample)
+		r.count++
+	} else {
+		end := (r.start + r.count) % len(r.samples)
+		r.samples[end] = sample
+		if r.count < len(r.samples) {
+			r.count++
+		} else {
+			r.start = (r.start + 1) % len(r.samples)
+		}
+	}
+	r.expire(sample.Timestamp)
+}
+
+// Returns samples with from <= timestamp <= to in chronological order. Zero from or to means no bound.
+func (r *Ring) Range(from, to time.Time) []metric.Sample {
+	r.expire(time.Now())
+
+	var out []metric.Sample
+	for i := 0; i < r.count; i++ {
+		sample := r.samples[(r.start+i)%len(r.samples)]
+		if !from.IsZero() && sample.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && sample.Timestamp.After(to) {
+			break
+		}
+		out = append(out, sample)
+	}
+	return out
+}
+
+func (r *Ring) Len() int {
+	return r.count
+}
+
+// Drops samples older than maxAge relative to now
+func (r *Ring) expire(now time.Time) {
+	if r.maxAge <= 0 {
+		return
+	}
+	deadline := now.Add(-r.maxAge)
+	for r.count > 0 && r.samples[r.start].Timestamp.Before(deadline) {
+		r.samples[r.start] = metric.Sample{}
+		r.start = (r.start + 1) % len(r.samples)
+		r.count--
+	}
+}
@@ -0,0 +1,64 @@
+package history
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func values(samples []metric.Sample) []string {
+	out := make([]string, 0, len(samples))
+	for _, s := range samples {
+		out = append(out, s.Value)
+	}
+	return out
+}
+
+func TestRing_Size(t *testing.T) {
+	r := NewRing(3, 0)
+	base := time.Now()
+	for i := 1; i <= 5; i++ {
+		r.Add(metric.Sample{Timestamp: base.Add(time.Duration(i) * time.Second), Value: strconv.Itoa(i)})
+	}
+
+	assert.Equal(t, 3, r.Len())
+	assert.Equal(t, []string{"3", "4", "5"}, values(r.Range(time.Time{}, time.Time{})))
+	assert.Equal(t, []string{"4"}, values(r.Range(base.Add(4*time.Second), base.Add(4500*time.Millisecond))))
+	assert.Empty(t, r.Range(base.Add(time.Minute), time.Time{}))
+}
+
+func TestRing_MaxAge(t *testing.T) {
+	r := NewRing(10, time.Minute)
+	now := time.Now()
+	r.Add(metric.Sample{Timestamp: now.Add(-2 * time.Minute), Value: "old"})
+	r.Add(metric.Sample{Timestamp: now.Add(-30 * time.Second), Value: "recent"})
+	r.Add(metric.Sample{Timestamp: now, Value: "now"})
+
+	assert.Equal(t, []string{"recent", "now"}, values(r.Range(time.Time{}, time.Time{})))
+}
+
+func TestRing_Disabled(t *testing.T) {
+	r := NewRing(0, 0)
+	r.Add(metric.Sample{Timestamp: time.Now(), Value: "1"})
+	assert.Equal(t, 0, r.Len())
+	assert.Empty(t, r.Range(time.Time{}, time.Time{}))
+}
+
+func TestRing_GrowsLazily(t *testing.T) {
+	r := NewRing(1000, time.Minute)
+	assert.Empty(t, r.samples)
+
+	now := time.Now()
+	r.Add(metric.Sample{Timestamp: now.Add(-2 * time.Minute), Value: "old"})
+	r.Add(metric.Sample{Timestamp: now.Add(-time.Second), Value: "1"})
+	assert.Len(t, r.samples, 2)
+
+	// the expired slot is reused before the ring grows, order is kept
+	r.Add(metric.Sample{Timestamp: now, Value: "2"})
+	r.Add(metric.Sample{Timestamp: now, Value: "3"})
+	assert.Len(t, r.samples, 3)
+	assert.Equal(t, []string{"1", "2", "3"}, values(r.Range(time.Time{}, time.Time{})))
+}
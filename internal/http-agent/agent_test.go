@@ -0,0 +1,352 @@
+package httpagent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	grpcserver "github.com/bazookajoe1/metrics-collector/internal/grpc-server"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newMetric(t *testing.T, mName, mType, mValue string) *metric.Metric {
+	m, err := metric.NewMetric(mName, mType, mValue)
+	require.NoError(t, err)
+	return m
+}
+
+// Collector returning counter that grows by one on every snapshot
+type stubCollector struct {
+	t     *testing.T
+	polls int
+}
+
+func (c *stubCollector) CollectMetrics() error              { return nil }
+func (c *stubCollector) Run(context.Context, time.Duration) {}
+func (c *stubCollector) GetMetrics() []*metric.Metric {
+	c.polls++
+	return []*metric.Metric{
+		newMetric(c.t, "PollCount", metric.Counter, strconv.Itoa(c.polls)),
+		newMetric(c.t, "Value", metric.Gauge, strconv.Itoa(c.polls*10)),
+	}
+}
+
+// Server summing counters like the real one does, fails with 500 while unavailable is set
+type stubServer struct {
+	unavailable atomic.Bool
+	mu          sync.Mutex
+	counter     int64
+	gauge       float64
+	labels      metric.Labels // labels of the last received metric
+}
+
+func (s *stubServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if s.unavailable.Load() {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var batch []metric.JSONMetric
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, jm := range batch {
+		if jm.Delta != nil {
+			s.counter += *jm.Delta
+		}
+		if jm.Value != nil {
+			s.gauge = *jm.Value
+		}
+		s.labels = jm.Labels
+	}
+}
+
+func newTestAgent(t *testing.T, ts *httptest.Server) *_HTTPAgent {
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	agent := AgentNew(u.Hostname(), u.Port(), &stubCollector{t: t}, time.Second, time.Second, log.New(io.Discard, "", 0))
+	agent.RetryBackoff = time.Millisecond
+	return agent
+}
+
+func TestAgent_ReportBuffersWhileServerUnavailable(t *testing.T) {
+	server := &stubServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	agent := newTestAgent(t, ts)
+
+	agent.deliver(agent.nextBatch())
+	assert.Equal(t, int64(1), server.counter)
+
+	server.unavailable.Store(true)
+	agent.deliver(agent.nextBatch())
+	agent.deliver(agent.nextBatch())
+	assert.Equal(t, int64(1), server.counter)
+	assert.Equal(t, 2, agent.buffer.Len()) // every unsent snapshot is kept separately
+
+	server.unavailable.Store(false)
+	agent.deliver(agent.nextBatch())
+	assert.Equal(t, 0, agent.buffer.Len())
+
+	// every poll is counted exactly once, gauge has the latest value
+	assert.Equal(t, int64(4), server.counter)
+	assert.Equal(t, float64(40), server.gauge)
+}
+
+func TestAgent_SendsLastSnapshotOnShutdown(t *testing.T) {
+	server := &stubServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	agent := newTestAgent(t, ts)
+	agent.ReportIntervall = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.Run(ctx)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent did not stop")
+	}
+	assert.Equal(t, int64(1), server.counter)
+	assert.Equal(t, float64(10), server.gauge)
+}
+
+func TestAgent_RetryConnectionRefused(t *testing.T) {
+	server := &stubServer{}
+	ts := httptest.NewServer(server)
+	agent := newTestAgent(t, ts)
+	ts.Close()
+
+	var attempts int
+	err := agent.withRetry(func() error {
+		attempts++
+		return agent.sendMetrics([]*metric.Metric{newMetric(t, "Value", metric.Gauge, "1")})
+	})
+	assert.True(t, isRetriable(err), err)
+	assert.Equal(t, agent.Retries+1, attempts)
+
+	// client errors are not retried
+	attempts = 0
+	err = agent.withRetry(func() error {
+		attempts++
+		return statusError(http.StatusBadRequest)
+	})
+	assert.Error(t, err)
+	assert.False(t, isRetriable(err))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestAgent_StaleGaugesAreNotResent(t *testing.T) {
+	server := &stubServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	agent := newTestAgent(t, ts)
+	agent.Retries = 0
+
+	// первый снимок не ушел и вернулся в буфер, пока другой отправитель доставлял второй
+	server.unavailable.Store(true)
+	older := agent.nextBatch()
+	agent.deliver(older)
+	returned := agent.buffer.Take()
+	server.unavailable.Store(false)
+	agent.deliver(agent.nextBatch())
+	assert.Equal(t, float64(20), server.gauge)
+
+	agent.deliver(returned)
+	assert.Equal(t, float64(20), server.gauge, "older gauge value must not overwrite the newer one")
+	assert.Equal(t, int64(2), server.counter, "counter deltas of the older snapshot are still delivered")
+}
+
+func TestAgent_BufferSize(t *testing.T) {
+	server := &stubServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	agent := newTestAgent(t, ts)
+	agent.Retries = 0
+	agent.SetBufferSize(3)
+
+	server.unavailable.Store(true)
+	for i := 0; i < 5; i++ {
+		agent.deliver(agent.nextBatch())
+	}
+	assert.Equal(t, 3, agent.buffer.Len())
+
+	server.unavailable.Store(false)
+	agent.deliver(agent.nextBatch())
+	assert.Equal(t, 0, agent.buffer.Len())
+	assert.Equal(t, int64(6), server.counter)
+	assert.Equal(t, float64(60), server.gauge)
+}
+
+func TestMetricsBuffer_Overflow(t *testing.T) {
+	buffer := newMetricsBuffer(2)
+	for i := 1; i <= 3; i++ {
+		buffer.Push([]*metric.Metric{
+			newMetric(t, "PollCount", metric.Counter, "1"),
+			newMetric(t, "Value", metric.Gauge, strconv.Itoa(i)),
+		})
+	}
+	assert.Equal(t, 2, buffer.Len())
+
+	// the two oldest snapshots are merged, the newest one is kept as is
+	snapshots := buffer.Take()
+	require.Len(t, snapshots, 2)
+	require.Len(t, snapshots[0].metrics, 2)
+	_, _, value := snapshots[0].metrics[0].GetParams()
+	assert.Equal(t, "2", value)
+	_, _, value = snapshots[0].metrics[1].GetParams()
+	assert.Equal(t, "2", value)
+	_, _, value = snapshots[1].metrics[1].GetParams()
+	assert.Equal(t, "3", value)
+	assert.Equal(t, 0, buffer.Len())
+
+	// returned snapshots go before the ones pushed meanwhile
+	buffer.Push([]*metric.Metric{newMetric(t, "Value", metric.Gauge, "4")})
+	buffer.Return(snapshots)
+	snapshots = buffer.Take()
+	require.Len(t, snapshots, 2)
+	_, _, value = snapshots[0].metrics[0].GetParams()
+	assert.Equal(t, "3", value)
+	_, _, value = snapshots[1].metrics[0].GetParams()
+	assert.Equal(t, "4", value)
+}
+
+func TestAgent_SendersRespectRateLimit(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if current <= peak || maxInFlight.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	agent := newTestAgent(t, ts)
+	agent.SetRateLimit(2)
+
+	batches := make(chan []snapshot)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent.sender(batches)
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		batches <- []snapshot{{metrics: []*metric.Metric{newMetric(t, "Value", metric.Gauge, "1")}}}
+	}
+	close(batches)
+	wg.Wait()
+
+	assert.Positive(t, maxInFlight.Load())
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(2))
+}
+
+func TestAgent_AttachesLabels(t *testing.T) {
+	server := &stubServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	agent := newTestAgent(t, ts)
+	agent.Labels = metric.Labels{"host": "web-1", "env": "prod"}
+
+	agent.deliver(agent.nextBatch())
+	assert.Equal(t, metric.Labels{"host": "web-1", "env": "prod"}, server.labels)
+}
+
+func TestAgent_HistogramDeltas(t *testing.T) {
+	agent := AgentNew("localhost", "8080", &stubCollector{t: t}, time.Second, time.Second, log.New(io.Discard, "", 0))
+
+	total, err := metric.NewHistogramValue([]float64{1})
+	require.NoError(t, err)
+	total.Observe(0.5)
+	deltas := agent.deltas([]*metric.Metric{newMetric(t, "Latency", metric.Histogram, total.String())})
+	_, _, value := deltas[0].GetParams()
+	assert.JSONEq(t, `{"bounds":[1],"counts":[1,0],"sum":0.5,"count":1}`, value)
+
+	total.Observe(2)
+	deltas = agent.deltas([]*metric.Metric{newMetric(t, "Latency", metric.Histogram, total.String())})
+	_, _, value = deltas[0].GetParams()
+	assert.JSONEq(t, `{"bounds":[1],"counts":[0,1],"sum":2,"count":1}`, value)
+}
+
+func TestAgent_GRPCTransport(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		strg := memstorage.NewInMemoryStorage()
+		serv := grpcserver.ServerNew("127.0.0.1:0", strg, log.New(io.Discard, "", 0))
+		serv.Key = "secret"
+		listener, err := net.Listen("tcp", serv.Address)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			serv.Serve(ctx, listener)
+		}()
+
+		transport, err := NewGRPCTransport(listener.Addr().String())
+		require.NoError(t, err)
+		transport.Stream = stream
+		transport.Compress = stream
+		transport.Key = "secret"
+
+		agent := AgentNew("localhost", "8080", &stubCollector{t: t}, time.Second, time.Second, log.New(io.Discard, "", 0))
+		agent.Transport = transport
+		agent.Labels = metric.Labels{"host": "web-1"}
+		agent.deliver(agent.nextBatch())
+		agent.deliver(agent.nextBatch())
+
+		value, err := strg.ReadMetric(metric.Counter, "PollCount", agent.Labels)
+		require.NoError(t, err, "stream %v", stream)
+		assert.Equal(t, "2", value, "stream %v", stream)
+		value, err = strg.ReadMetric(metric.Gauge, "Value", agent.Labels)
+		require.NoError(t, err, "stream %v", stream)
+		assert.Equal(t, "20", value, "stream %v", stream)
+
+		require.NoError(t, transport.Close())
+		cancel()
+		<-done
+	}
+}
+
+func TestClassifyGRPCError(t *testing.T) {
+	assert.True(t, isRetriable(classifyGRPCError(status.Error(codes.Unavailable, "connection refused"))))
+	assert.False(t, isRetriable(classifyGRPCError(status.Error(codes.InvalidArgument, "bad metric"))))
+	assert.NoError(t, classifyGRPCError(nil))
+}
@@ -0,0 +1,109 @@
+package httpagent
+
+import (
+	"sync"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Metrics taken from the collector at once. Snapshots are numbered in the order they are taken,
+// so it is known which gauge values are newer.
+type snapshot struct {
+	seq     uint64
+	metrics []*metric.Metric
+}
+
+// metricsBuffer keeps snapshots that are not delivered to the server yet.
+// When the buffer is full the two oldest snapshots are merged, so counter deltas are never lost
+// and only intermediate gauge values are dropped.
+type metricsBuffer struct {
+	snapshots []snapshot
+	size      int
+	seq       uint64 // number of the last pushed snapshot
+	mu        sync.Mutex
+}
+
+func newMetricsBuffer(size int) *metricsBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &metricsBuffer{size: size}
+}
+
+// Adds metrics to the end of the buffer as the newest snapshot
+func (b *metricsBuffer) Push(metrics []*metric.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	b.snapshots = append(b.snapshots, snapshot{seq: b.seq, metrics: metrics})
+	b.shrink()
+}
+
+// Returns snapshots to the beginning of the buffer, e.g. after unsuccessful send
+func (b *metricsBuffer) Return(snapshots []snapshot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.snapshots = append(append([]snapshot{}, snapshots...), b.snapshots...)
+	b.shrink()
+}
+
+// Removes all snapshots from the buffer and returns them, the oldest first
+func (b *metricsBuffer) Take() []snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshots := b.snapshots
+	b.snapshots = nil
+
+	return snapshots
+}
+
+// Merges the oldest snapshots until the buffer fits its size. Returned snapshots may be newer
+// than the ones pushed meanwhile, so the merged one takes the number of the newer of the two.
+func (b *metricsBuffer) shrink() {
+	for len(b.snapshots) > b.size {
+		older, newer := b.snapshots[0], b.snapshots[1]
+		if older.seq > newer.seq {
+			older, newer = newer, older
+		}
+		merged := snapshot{seq: newer.seq, metrics: mergeSnapshots(older.metrics, newer.metrics)}
+		b.snapshots = append([]snapshot{merged}, b.snapshots[2:]...)
+	}
+}
+
+func (b *metricsBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.snapshots)
+}
+
+// Merges newer snapshot into older one: counter deltas are summed, the newer gauge value wins
+func mergeSnapshots(older, newer []*metric.Metric) []*metric.Metric {
+	merged := make([]*metric.Metric, 0, len(older)+len(newer))
+	index := make(map[[2]string]*metric.Metric, len(older))
+
+	for _, m := range older {
+		mName, mType, _ := m.GetParams()
+		copied := *m
+		index[[2]string{mName, mType}] = &copied
+		merged = append(merged, &copied)
+	}
+
+	for _, m := range newer {
+		mName, mType, mValue := m.GetParams()
+		if existing, ok := index[[2]string{mName, mType}]; ok {
+			// UpdateMetric sums counters and replaces gauges, exactly what we need here
+			if err := existing.UpdateMetric(mValue); err == nil {
+				continue
+			}
+		}
+		copied := *m
+		index[[2]string{mName, mType}] = &copied
+		merged = append(merged, &copied)
+	}
+
+	return merged
+}
@@ -0,0 +1,122 @@
+package httpagent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/hashing"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	pb "github.com/bazookajoe1/metrics-collector/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Transport sends batches to the server instead of HTTP requests
+type Transport interface {
+	Send(ctx context.Context, metrics []*metric.Metric) error
+	Close() error
+}
+
+// grpcTransport sends batches with UpdateMetrics, or with StreamMetrics when Stream is set.
+// Stream is not limited by the gRPC message size, so it suits large snapshots.
+// All calls go over one connection.
+type grpcTransport struct {
+	Stream   bool
+	Compress bool   // gzip requests
+	Key      string // HMAC key, requests are signed when set
+	Timeout  time.Duration
+	conn     *grpc.ClientConn
+	client   pb.MetricsClient
+}
+
+func NewGRPCTransport(address string) (*grpcTransport, error) {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcTransport{
+		Timeout: defaultRequestTimeout,
+		conn:    conn,
+		client:  pb.NewMetricsClient(conn),
+	}, nil
+}
+
+func (t *grpcTransport) Send(ctx context.Context, metrics []*metric.Metric) error {
+	batch := make([]*pb.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		pm, err := pb.FromMetric(m)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, pm)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	var opts []grpc.CallOption
+	if t.Compress {
+		opts = append(opts, grpc.UseCompressor(gzip.Name))
+	}
+
+	var err error
+	if t.Stream {
+		err = t.stream(ctx, batch, opts)
+	} else {
+		err = t.unary(ctx, batch, opts)
+	}
+	return classifyGRPCError(err)
+}
+
+func (t *grpcTransport) unary(ctx context.Context, batch []*pb.Metric, opts []grpc.CallOption) error {
+	req := &pb.UpdateMetricsRequest{Metrics: batch}
+	if t.Key != "" {
+		sign, err := pb.Sign(req, t.Key)
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(hashing.Header), sign)
+	}
+	_, err := t.client.UpdateMetrics(ctx, req, opts...)
+	return err
+}
+
+// The server applies the stream only after it is complete, so a stream dropped midway may be repeated
+func (t *grpcTransport) stream(ctx context.Context, batch []*pb.Metric, opts []grpc.CallOption) error {
+	stream, err := t.client.StreamMetrics(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	for _, pm := range batch {
+		req := &pb.StreamMetricsRequest{Metric: pm}
+		if t.Key != "" {
+			if req.Hash, err = pb.Sign(pm, t.Key); err != nil {
+				return err
+			}
+		}
+		if err := stream.Send(req); err != nil {
+			// настоящая причина придет вместе со статусом
+			break
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func (t *grpcTransport) Close() error {
+	return t.conn.Close()
+}
+
+// Wraps errors of calls that may succeed if repeated later
+func classifyGRPCError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return &retriableError{err: err}
+	}
+	return err
+}
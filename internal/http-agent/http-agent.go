@@ -1,11 +1,19 @@
 package httpagent
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/bazookajoe1/metrics-collector/internal/encryption"
+	"github.com/bazookajoe1/metrics-collector/internal/hashing"
 	"github.com/bazookajoe1/metrics-collector/internal/metric"
 	"github.com/go-resty/resty/v2"
 )
@@ -17,58 +25,330 @@ type _HTTPAgent struct {
 	Collector       MetricCollector
 	PollInterval    time.Duration
 	ReportIntervall time.Duration
+	Compress        bool           // gzip request bodies
+	Key             string         // HMAC key, requests are signed when set
+	PublicKey       *rsa.PublicKey // server key, requests are encrypted when set
+	Retries         int            // how many times to repeat failed request
+	RetryBackoff    time.Duration  // delay before the first retry, doubled every next one
+	Workers         int            // how many goroutines send batches
+	Labels          metric.Labels  // attached to every sent metric
+	Transport       Transport      // sends batches instead of HTTP requests when set, e.g. over gRPC
 	Logger          *log.Logger
+	buffer          *metricsBuffer
+	lastCounters    map[string]int64                  // counter values already taken into buffer
+	lastHistograms  map[string]*metric.HistogramValue // histograms already taken into buffer
+	limiter         chan struct{}                     // semaphore limiting concurrent requests
+	gaugesMu        sync.Mutex
+	sentGauges      map[[2]string]uint64 // number of the snapshot each gauge was last delivered with
 }
 
 type MetricCollector interface {
 	CollectMetrics() error
 	GetMetrics() []*metric.Metric
-	Run(time.Duration)
+	Run(context.Context, time.Duration)
 }
 
+const (
+	defaultRetries        = 3
+	defaultRetryBackoff   = time.Second
+	defaultBufferSize     = 100
+	defaultRequestTimeout = 5 * time.Second
+	defaultWorkers        = 2
+	defaultRateLimit      = 2
+)
+
 func AgentNew(address string, port string, collector MetricCollector, pollInterval time.Duration, reportInterval time.Duration, logger *log.Logger) *_HTTPAgent {
 	return &_HTTPAgent{
-		Client:          resty.New(),
+		Client:          resty.New().SetTimeout(defaultRequestTimeout),
 		Address:         address,
 		Port:            port,
 		Collector:       collector,
 		PollInterval:    pollInterval,
 		ReportIntervall: reportInterval,
+		Retries:         defaultRetries,
+		RetryBackoff:    defaultRetryBackoff,
+		Workers:         defaultWorkers,
 		Logger:          logger,
+		buffer:          newMetricsBuffer(defaultBufferSize),
+		lastCounters:    make(map[string]int64),
+		lastHistograms:  make(map[string]*metric.HistogramValue),
+		limiter:         make(chan struct{}, defaultRateLimit),
+		sentGauges:      make(map[[2]string]uint64),
 	}
 }
 
-func (agent *_HTTPAgent) Run() {
-	wg := sync.WaitGroup{}
+// Sets how many unsent snapshots are kept while the server is unavailable
+func (agent *_HTTPAgent) SetBufferSize(size int) {
+	agent.buffer = newMetricsBuffer(size)
+}
 
-	wg.Add(1)
-	go agent.Collector.Run(agent.PollInterval)
+// Sets how many requests may be in flight at the same time
+func (agent *_HTTPAgent) SetRateLimit(limit int) {
+	agent.limiter = make(chan struct{}, limit)
+}
+
+// Collects metrics in its own goroutine, takes snapshots every ReportIntervall and hands them
+// over to the pool of senders, so a slow request never delays collection or the next report.
+// When ctx is done collection stops and the last snapshot is sent before returning.
+func (agent *_HTTPAgent) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
 
 	wg.Add(1)
 	go func() {
-		for {
-			time.Sleep(agent.ReportIntervall * time.Second)
-			metrics := agent.Collector.GetMetrics()
-			agent.sendMetrics(metrics)
-		}
+		defer wg.Done()
+		agent.Collector.Run(ctx, agent.PollInterval)
 	}()
 
+	batches := make(chan []snapshot, agent.Workers)
+	for i := 0; i < agent.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent.sender(batches)
+		}()
+	}
+
+	ticker := time.NewTicker(agent.ReportIntervall)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+
+		batch := agent.nextBatch()
+		select {
+		case batches <- batch:
+		default:
+			// все отправители заняты, отправим вместе со следующим снимком
+			agent.buffer.Return(batch)
+			agent.Logger.Println("all senders are busy, snapshot is buffered")
+		}
+	}
+
+	// ждем завершения сбора и текущих отправок, потом отправляем все, что осталось
+	close(batches)
 	wg.Wait()
+
+	agent.Logger.Println("sending the last snapshot")
+	agent.deliver(agent.nextBatch())
+}
+
+// Takes snapshot from the collector and returns it together with everything buffered earlier, the oldest first
+func (agent *_HTTPAgent) nextBatch() []snapshot {
+	agent.buffer.Push(agent.deltas(agent.Collector.GetMetrics()))
+	return agent.buffer.Take()
+}
+
+// Sends batches from the channel until it is closed
+func (agent *_HTTPAgent) sender(batches <-chan []snapshot) {
+	for batch := range batches {
+		agent.deliver(batch)
+	}
+}
+
+// Sends snapshots one by one with retries. If the server is unavailable the unsent snapshots go back
+// to the buffer and are sent with the next snapshot.
+// Senders work concurrently, so a returned snapshot may be sent after a newer one. Its gauges that were
+// already delivered with a newer snapshot are not sent again. Two snapshots in flight at the same time
+// may still reach the server in any order, then the stale gauge value is fixed by the next report.
+func (agent *_HTTPAgent) deliver(snapshots []snapshot) {
+	for i, s := range snapshots {
+		metrics := agent.withoutStaleGauges(s)
+		err := agent.withRetry(func() error {
+			if agent.Transport != nil {
+				return agent.sendTransport(metrics)
+			}
+			return agent.sendMetrics(metrics)
+		})
+		if isRetriable(err) {
+			agent.buffer.Return(snapshots[i:])
+			agent.Logger.Printf("server is unavailable, %d snapshots buffered: %v", agent.buffer.Len(), err)
+			return
+		}
+		if err != nil {
+			agent.Logger.Println("metrics dropped:", err)
+			continue
+		}
+		agent.markSent(s)
+	}
+}
+
+// Returns metrics of the snapshot except gauges already delivered with a newer snapshot
+func (agent *_HTTPAgent) withoutStaleGauges(s snapshot) []*metric.Metric {
+	agent.gaugesMu.Lock()
+	defer agent.gaugesMu.Unlock()
+
+	metrics := make([]*metric.Metric, 0, len(s.metrics))
+	for _, m := range s.metrics {
+		mName, mType, _ := m.GetParams()
+		if mType == metric.Gauge && agent.sentGauges[[2]string{mName, mType}] > s.seq {
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func (agent *_HTTPAgent) markSent(s snapshot) {
+	agent.gaugesMu.Lock()
+	defer agent.gaugesMu.Unlock()
+
+	for _, m := range s.metrics {
+		mName, mType, _ := m.GetParams()
+		key := [2]string{mName, mType}
+		if mType == metric.Gauge && agent.sentGauges[key] < s.seq {
+			agent.sentGauges[key] = s.seq
+		}
+	}
+}
+
+// Replaces total counter and histogram values from the collector with increments since
+// the previous snapshot, because the server adds up everything it receives
+func (agent *_HTTPAgent) deltas(metrics []*metric.Metric) []*metric.Metric {
+	for i, m := range metrics {
+		mName, mType, mValue := m.GetParams()
+		if mType == metric.Histogram {
+			metrics[i] = agent.histogramDelta(m)
+			continue
+		}
+		if mType != metric.Counter {
+			continue
+		}
+
+		total, err := strconv.ParseInt(mValue, 10, 64)
+		if err != nil {
+			agent.Logger.Println(err)
+			continue
+		}
+		delta, err := metric.NewMetric(mName, mType, strconv.FormatInt(total-agent.lastCounters[mName], 10))
+		if err != nil {
+			agent.Logger.Println(err)
+			continue
+		}
+		agent.lastCounters[mName] = total
+		metrics[i] = delta
+	}
+
+	return metrics
 }
 
-func (agent *_HTTPAgent) sendMetrics(metrics []*metric.Metric) {
-	for _, metric := range metrics {
-		mName, mType, mValue := metric.GetParams()
-		endpoint := fmt.Sprintf("%s/%s/%s", mType, mName, mValue)
-		url := fmt.Sprintf("http://%s:%s/update/%s", agent.Address, agent.Port, endpoint)
+// Returns observations since the previous snapshot. If buckets were changed, the whole histogram is sent.
+func (agent *_HTTPAgent) histogramDelta(m *metric.Metric) *metric.Metric {
+	mName, mType, mValue := m.GetParams()
+	total, err := metric.ParseHistogram(mValue)
+	if err != nil {
+		agent.Logger.Println(err)
+		return m
+	}
+	prev, ok := agent.lastHistograms[mName]
+	agent.lastHistograms[mName] = total
+	if !ok {
+		return m
+	}
+	diff, err := total.Sub(prev)
+	if err != nil {
+		return m
+	}
+	delta, err := metric.NewMetric(mName, mType, diff.String())
+	if err != nil {
+		agent.Logger.Println(err)
+		return m
+	}
+	return delta
+}
 
-		response, err := agent.Client.R().SetHeader("Content-Type", "text/plain").Post(url)
+// Sends the whole snapshot of metrics in one JSON request
+func (agent *_HTTPAgent) sendMetrics(metrics []*metric.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	batch := make([]*metric.JSONMetric, 0, len(metrics))
+	for _, m := range metrics {
+		jm, err := m.ToJSON()
 		if err != nil {
 			agent.Logger.Println(err)
 			continue
 		}
+		if len(agent.Labels) > 0 {
+			jm.Labels = agent.Labels
+		}
+		batch = append(batch, jm)
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
 
-		agent.Logger.Println(url, response.StatusCode())
+	url := fmt.Sprintf("http://%s:%s/updates/", agent.Address, agent.Port)
 
+	request := agent.Client.R().SetHeader("Content-Type", "application/json")
+	if agent.Key != "" {
+		request.SetHeader(hashing.Header, hashing.Sign(body, agent.Key))
+	}
+	if agent.Compress {
+		body, err = compress(body)
+		if err != nil {
+			return err
+		}
+		request.SetHeader("Content-Encoding", "gzip")
+	}
+	if agent.PublicKey != nil {
+		body, err = encryption.Encrypt(agent.PublicKey, body)
+		if err != nil {
+			return err
+		}
+		request.SetHeader(encryption.Header, encryption.Scheme)
+	}
+
+	agent.limiter <- struct{}{}
+	response, err := request.SetBody(body).Post(url)
+	<-agent.limiter
+	if err != nil {
+		return classifyError(err)
+	}
+
+	agent.Logger.Println(url, len(batch), response.StatusCode())
+
+	return statusError(response.StatusCode())
+}
+
+// Sends the snapshot with Transport
+func (agent *_HTTPAgent) sendTransport(metrics []*metric.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if len(agent.Labels) > 0 {
+		for _, m := range metrics {
+			if err := m.SetLabels(agent.Labels); err != nil {
+				return err
+			}
+		}
+	}
+
+	agent.limiter <- struct{}{}
+	err := agent.Transport.Send(context.Background(), metrics)
+	<-agent.limiter
+	if err != nil {
+		return err
+	}
+
+	agent.Logger.Println("sent", len(metrics), "metrics")
+	return nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,69 @@
+package httpagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Error of the request that may succeed if repeated later
+type retriableError struct {
+	err error
+}
+
+func (e *retriableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retriableError) Unwrap() error {
+	return e.err
+}
+
+// Wraps transport errors that are worth retrying: connection refused or reset, timeouts
+func classifyError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return &retriableError{err: err}
+	}
+	return err
+}
+
+// Returns error for unsuccessful status code. Server errors are retriable.
+func statusError(statusCode int) error {
+	switch {
+	case statusCode >= 500:
+		return &retriableError{err: fmt.Errorf("server responded with %d", statusCode)}
+	case statusCode >= 400:
+		return fmt.Errorf("server responded with %d", statusCode)
+	}
+	return nil
+}
+
+func isRetriable(err error) bool {
+	var retriable *retriableError
+	return errors.As(err, &retriable)
+}
+
+// Calls fn until it succeeds, returns not retriable error or retries are exhausted.
+// Delay before the n-th retry is backoff * 2^(n-1).
+func (agent *_HTTPAgent) withRetry(fn func() error) error {
+	err := fn()
+	delay := agent.RetryBackoff
+	for attempt := 1; attempt <= agent.Retries && isRetriable(err); attempt++ {
+		agent.Logger.Printf("attempt %d failed: %v, retrying in %v", attempt, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/alerting"
+	"github.com/go-chi/chi/v5"
+)
+
+// Returns current alerts as JSON list. Query parameter state keeps only alerts in that state.
+func (serv *_HTTPServer) AlertList(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	state := req.URL.Query().Get("state")
+	switch state {
+	case "", alerting.StatePending, alerting.StateFiring, alerting.StateResolved:
+	default:
+		http.Error(res, fmt.Sprintf("invalid alert state %s", state), http.StatusBadRequest)
+		return
+	}
+
+	alerts := make([]alerting.Alert, 0)
+	if serv.Alerter != nil {
+		for _, alert := range serv.Alerter.Alerts() {
+			if state == "" || alert.State == state {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(res).Encode(alerts); err != nil {
+		serv.Logger.Println(err)
+	}
+}
+
+// Returns active silences as JSON list
+func (serv *_HTTPServer) SilenceList(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	if serv.Silencer == nil {
+		http.Error(res, "notifications are not configured", http.StatusNotImplemented)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(res).Encode(serv.Silencer.Silences()); err != nil {
+		serv.Logger.Println(err)
+	}
+}
+
+// Creates silence from JSON body and returns it with the assigned id
+func (serv *_HTTPServer) SilenceAdd(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	if serv.Silencer == nil {
+		http.Error(res, "notifications are not configured", http.StatusNotImplemented)
+		return
+	}
+
+	var silence alerting.Silence
+	if err := json.NewDecoder(req.Body).Decode(&silence); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	silence, err := serv.Silencer.AddSilence(silence)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serv.Logger.Printf("silence %s added till %s", silence.ID, silence.EndsAt.Format(time.RFC3339))
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(res).Encode(silence); err != nil {
+		serv.Logger.Println(err)
+	}
+}
+
+// Removes silence by id
+func (serv *_HTTPServer) SilenceDelete(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	if serv.Silencer == nil {
+		http.Error(res, "notifications are not configured", http.StatusNotImplemented)
+		return
+	}
+
+	id := chi.URLParam(req, "id")
+	err := serv.Silencer.DeleteSilence(id)
+	if errors.Is(err, alerting.ErrSilenceNotFound) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serv.Logger.Printf("silence %s deleted", id)
+	res.WriteHeader(http.StatusOK)
+}
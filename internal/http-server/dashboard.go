@@ -0,0 +1,99 @@
+package httpserver
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+//go:embed templates/dashboard.html
+var templates embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(templates, "templates/dashboard.html"))
+
+// How often the dashboard reloads itself, in seconds, unless ?refresh= is given
+const defaultDashboardRefresh = 10
+
+type dashboardMetric struct {
+	Name    string
+	Labels  string
+	Value   string
+	Updated time.Time
+}
+
+type dashboardGroup struct {
+	Type    string
+	Metrics []dashboardMetric
+}
+
+type dashboardPage struct {
+	Filter  string
+	Refresh int
+	Groups  []dashboardGroup
+}
+
+// Renders HTML page with all metrics grouped by type and sorted by name.
+// Query parameters: filter - case insensitive substring of the name or labels, refresh - reload interval in seconds, 0 disables.
+func (serv *_HTTPServer) MetricAll(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	page := dashboardPage{
+		Filter:  req.URL.Query().Get("filter"),
+		Refresh: defaultDashboardRefresh,
+	}
+	if refresh, err := strconv.Atoi(req.URL.Query().Get("refresh")); err == nil && refresh >= 0 {
+		page.Refresh = refresh
+	}
+
+	metrics, err := serv.Strg.ListMetrics()
+	if err != nil {
+		serv.Logger.Println(err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page.Groups = groupMetrics(metrics, page.Filter)
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(res, page); err != nil {
+		serv.Logger.Println(err)
+	}
+}
+
+// Groups metrics by type keeping the storage order, which is sorted by name
+func groupMetrics(metrics []*metric.Metric, filter string) []dashboardGroup {
+	filter = strings.ToLower(filter)
+
+	var groups []dashboardGroup
+	index := make(map[string]int)
+	for _, m := range metrics {
+		mName, mType, mValue := m.GetParams()
+		if !strings.Contains(strings.ToLower(m.SeriesKey()), filter) {
+			continue
+		}
+
+		i, ok := index[mType]
+		if !ok {
+			i = len(groups)
+			index[mType] = i
+			groups = append(groups, dashboardGroup{Type: mType})
+		}
+		if mType == metric.Histogram {
+			if h, err := metric.ParseHistogram(mValue); err == nil {
+				mValue = h.Summary()
+			}
+		}
+		groups[i].Metrics = append(groups[i].Metrics, dashboardMetric{
+			Name:    mName,
+			Labels:  m.Labels().String(),
+			Value:   mValue,
+			Updated: m.UpdatedAt(),
+		})
+	}
+
+	return groups
+}
@@ -0,0 +1,42 @@
+package httpserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/bazookajoe1/metrics-collector/internal/encryption"
+)
+
+// Decrypts request bodies marked with the encryption header. Does nothing when the private key is not set.
+func (serv *_HTTPServer) DecryptMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		scheme := req.Header.Get(encryption.Header)
+		if scheme == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+		if serv.PrivateKey == nil || scheme != encryption.Scheme {
+			http.Error(res, "unsupported encryption", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body, err = encryption.Decrypt(serv.PrivateKey, body)
+		if err != nil {
+			serv.Logger.Println("decrypt", req.URL.Path, err)
+			http.Error(res, "can't decrypt request", http.StatusBadRequest)
+			return
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Del(encryption.Header)
+		next.ServeHTTP(res, req)
+	})
+}
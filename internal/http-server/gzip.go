@@ -0,0 +1,87 @@
+package httpserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Content types worth compressing
+var compressibleTypes = []string{"application/json", "text/html"}
+
+type gzipWriter struct {
+	http.ResponseWriter
+	zw          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if isCompressible(w.Header().Get("Content-Type")) && statusCode != http.StatusNoContent {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.zw = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.zw != nil {
+		return w.zw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *gzipWriter) Close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	return nil
+}
+
+// Decompresses gzip request bodies and compresses responses for clients accepting gzip
+func (serv *_HTTPServer) GzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.Header.Get("Content-Encoding"), "gzip") {
+			zr, err := gzip.NewReader(req.Body)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			req.Body = io.NopCloser(zr)
+			req.Header.Del("Content-Encoding")
+			req.ContentLength = -1
+		}
+
+		if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: res}
+		defer func() {
+			if err := gw.Close(); err != nil {
+				serv.Logger.Println(err)
+			}
+		}()
+		next.ServeHTTP(gw, req)
+	})
+}
+
+func isCompressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/bazookajoe1/metrics-collector/internal/metric"
@@ -13,17 +14,29 @@ func (serv *_HTTPServer) MetricSave(res http.ResponseWriter, req *http.Request)
 
 	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
+	labels, err := queryLabels(req)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	metric, err := metric.NewMetric(chi.URLParam(req, "name"),
 		chi.URLParam(req, "type"),
 		chi.URLParam(req, "value"))
 
 	if err != nil {
 		res.WriteHeader(http.StatusBadRequest)
+		return
 	}
-
-	serv.Strg.UpdateMetric(metric)
-	if err != nil {
+	if err := metric.SetLabels(labels); err != nil {
 		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := serv.Strg.UpdateMetric(metric); err != nil {
+		serv.Logger.Println(err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	res.Write([]byte{})
@@ -35,7 +48,13 @@ func (serv *_HTTPServer) MetricRead(res http.ResponseWriter, req *http.Request)
 
 	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
-	value, err := serv.Strg.ReadMetric(chi.URLParam(req, "type"), chi.URLParam(req, "name"))
+	labels, err := queryLabels(req)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	value, err := serv.Strg.ReadMetric(chi.URLParam(req, "type"), chi.URLParam(req, "name"), labels)
 	if err != nil {
 		res.WriteHeader(http.StatusNotFound)
 	}
@@ -45,11 +64,128 @@ func (serv *_HTTPServer) MetricRead(res http.ResponseWriter, req *http.Request)
 	_ = err
 }
 
-func (serv *_HTTPServer) MetricAll(res http.ResponseWriter, req *http.Request) {
+// Reports whether the storage database is reachable
+func (serv *_HTTPServer) Ping(res http.ResponseWriter, req *http.Request) {
 	serv.Logger.Println("Request", req.URL.Path)
 
-	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	pinger, ok := serv.Strg.(Pinger)
+	if !ok {
+		http.Error(res, "database is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	if err := pinger.Ping(); err != nil {
+		serv.Logger.Println(err)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+func (serv *_HTTPServer) MetricSaveJSON(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	var jm metric.JSONMetric
+	if err := json.NewDecoder(req.Body).Decode(&jm); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, err := metric.NewMetricFromJSON(&jm)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := serv.Strg.UpdateMetric(m); err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// отдаем актуальное значение из хранилища, для counter это уже сумма
+	value, err := serv.Strg.ReadMetric(jm.MType, jm.ID, m.Labels())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	serv.writeJSONMetric(res, jm.ID, jm.MType, m.Labels(), value)
+}
+
+// Saves array of JSON metrics. The batch is validated first and then applied to storage at once.
+func (serv *_HTTPServer) MetricSaveBatch(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	var batch []metric.JSONMetric
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics := make([]*metric.Metric, 0, len(batch))
+	for i := range batch {
+		m, err := metric.NewMetricFromJSON(&batch[i])
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metrics = append(metrics, m)
+	}
+
+	if err := serv.Strg.UpdateMetrics(metrics); err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Write([]byte("{}"))
+}
+
+func (serv *_HTTPServer) MetricReadJSON(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	var jm metric.JSONMetric
+	if err := json.NewDecoder(req.Body).Decode(&jm); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if jm.ID == "" || !metric.CheckType(jm.MType) {
+		http.Error(res, "invalid metric id or type", http.StatusBadRequest)
+		return
+	}
+	if err := jm.Labels.Validate(); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value, err := serv.Strg.ReadMetric(jm.MType, jm.ID, jm.Labels)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	serv.writeJSONMetric(res, jm.ID, jm.MType, jm.Labels, value)
+}
+
+func (serv *_HTTPServer) writeJSONMetric(res http.ResponseWriter, mName, mType string, labels metric.Labels, mValue string) {
+	out, err := metric.ToJSON(mName, mType, mValue)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(labels) > 0 {
+		out.Labels = labels
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(res).Encode(out); err != nil {
+		serv.Logger.Println(err)
+	}
+}
 
-	metrics := serv.Strg.ReadAllMetrics()
-	res.Write([]byte(metrics))
+// Returns labels of the series from ?labels=name=value,name2=value2, nil if not given
+func queryLabels(req *http.Request) (metric.Labels, error) {
+	return metric.ParseLabels(req.URL.Query().Get("labels"))
 }
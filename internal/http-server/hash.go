@@ -0,0 +1,87 @@
+package httpserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/bazookajoe1/metrics-collector/internal/hashing"
+)
+
+// Collects response so that its hash can be sent in the header before the body
+type hashWriter struct {
+	http.ResponseWriter
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (w *hashWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+// Verifies HashSHA256 of request bodies and signs responses. Does nothing when the key is not set.
+// Requests with a body and all POST and DELETE requests must carry the hash, mismatches are rejected with 400.
+// Requests without body, e.g. POST /update/{type}/{name}/{value}, carry their data in the path,
+// so the hash of the path is expected for them.
+func (serv *_HTTPServer) HashMiddleware(next http.Handler) http.Handler {
+	return serv.hashMiddleware(next, false)
+}
+
+// Same as HashMiddleware, but requests without the hash are let through unsigned.
+// If the hash is sent it is still verified.
+func (serv *_HTTPServer) OptionalHashMiddleware(next http.Handler) http.Handler {
+	return serv.hashMiddleware(next, true)
+}
+
+func (serv *_HTTPServer) hashMiddleware(next http.Handler, optional bool) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if serv.Key == "" || (optional && req.Header.Get(hashing.Header) == "") {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		sign := req.Header.Get(hashing.Header)
+		if (len(body) > 0 || sign != "" || changesState(req)) && !hashing.Verify(signedData(req, body), serv.Key, sign) {
+			serv.Logger.Println("hash mismatch", req.URL.Path)
+			http.Error(res, "hash mismatch", http.StatusBadRequest)
+			return
+		}
+
+		hw := &hashWriter{ResponseWriter: res}
+		next.ServeHTTP(hw, req)
+
+		if hw.statusCode == 0 {
+			hw.statusCode = http.StatusOK
+		}
+		res.Header().Set(hashing.Header, hashing.Sign(hw.body.Bytes(), serv.Key))
+		res.WriteHeader(hw.statusCode)
+		if _, err := res.Write(hw.body.Bytes()); err != nil {
+			serv.Logger.Println(err)
+		}
+	})
+}
+
+func changesState(req *http.Request) bool {
+	return req.Method == http.MethodPost || req.Method == http.MethodDelete
+}
+
+// Returns what the client signs: the body, or the path if there is no body
+func signedData(req *http.Request, body []byte) []byte {
+	if len(body) == 0 {
+		return []byte(req.URL.Path)
+	}
+	return body
+}
@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/go-chi/chi/v5"
+)
+
+type historySample struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Delta     *int64                 `json:"delta,omitempty"`
+	Value     *float64               `json:"value,omitempty"`
+	Histogram *metric.HistogramValue `json:"histogram,omitempty"`
+}
+
+type historyResponse struct {
+	ID      string          `json:"id"`
+	MType   string          `json:"type"`
+	Labels  metric.Labels   `json:"labels,omitempty"`
+	Samples []historySample `json:"samples"`
+}
+
+// Returns stored samples of the metric as JSON.
+// Query parameters from and to limit the period, both accept RFC 3339 time or unix seconds,
+// labels selects the series as in other text routes.
+func (serv *_HTTPServer) MetricHistory(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	mType, mName := chi.URLParam(req, "type"), chi.URLParam(req, "name")
+	if !metric.CheckType(mType) {
+		http.Error(res, fmt.Sprintf("invalid metric type %s", mType), http.StatusBadRequest)
+		return
+	}
+
+	labels, err := queryLabels(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTimeParam(req.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(req.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := serv.Strg.ReadMetric(mType, mName, labels); err != nil {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	samples, err := serv.Strg.ReadHistory(mType, mName, labels, from, to)
+	if err != nil {
+		serv.Logger.Println(err)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := historyResponse{ID: mName, MType: mType, Labels: labels, Samples: make([]historySample, 0, len(samples))}
+	for _, sample := range samples {
+		jm, err := metric.ToJSON(mName, mType, sample.Value)
+		if err != nil {
+			serv.Logger.Println(err)
+			continue
+		}
+		out.Samples = append(out.Samples, historySample{Timestamp: sample.Timestamp, Delta: jm.Delta, Value: jm.Value, Histogram: jm.Histogram})
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(res).Encode(out); err != nil {
+		serv.Logger.Println(err)
+	}
+}
+
+// Parses RFC 3339 time or unix seconds, empty value is zero time
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or unix seconds", value)
+	}
+	return t, nil
+}
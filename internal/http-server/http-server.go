@@ -1,19 +1,43 @@
 package httpserver
 
 import (
+	"context"
+	"crypto/rsa"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"os"
+	"sync"
+	"time"
 
+	"github.com/bazookajoe1/metrics-collector/internal/alerting"
 	"github.com/bazookajoe1/metrics-collector/internal/metric"
 	"github.com/go-chi/chi/v5"
 )
 
 type Storage interface {
-	UpdateMetric(*metric.Metric)
-	ReadMetric(mType string, mName string) (string, error)
-	ReadAllMetrics() string
+	UpdateMetric(*metric.Metric) error
+	UpdateMetrics([]*metric.Metric) error
+	ReadMetric(mType string, mName string, labels metric.Labels) (string, error)
+	ListMetrics() ([]*metric.Metric, error)
+	ReadHistory(mType string, mName string, labels metric.Labels, from, to time.Time) ([]metric.Sample, error)
+}
+
+// Source of alert states, e.g. the alerting engine
+type Alerter interface {
+	Alerts() []alerting.Alert
+}
+
+// Keeps silences of alert notifications
+type Silencer interface {
+	Silences() []alerting.Silence
+	AddSilence(alerting.Silence) (alerting.Silence, error)
+	DeleteSilence(id string) error
+}
+
+// Storage backed by a database that can check its connection
+type Pinger interface {
+	Ping() error
 }
 
 type _HTTPServer struct {
@@ -21,7 +45,22 @@ type _HTTPServer struct {
 	Port    string
 	Router  *chi.Mux
 	Strg    Storage
-	Logger  *log.Logger
+	Key     string // HMAC key, requests and responses are signed when set
+	// Private key for requests encrypted by agents
+	PrivateKey *rsa.PrivateKey
+	// Alerting engine, /alerts returns empty list when not set
+	Alerter Alerter
+	// Alert notifier, silences routes respond 501 when not set
+	Silencer Silencer
+	// Names of InfluxDB fields with these suffixes are counters
+	InfluxCounterSuffixes []string
+	// /write accepts requests without HashSHA256 even when the key is set, e.g. from Telegraf
+	InfluxUnsigned bool
+	Logger         *log.Logger
+
+	influxMu     sync.Mutex
+	influxTotals map[string]influxTotal // last totals of InfluxDB counters by series key
+	influxPruned time.Time              // when influxTotals were pruned last time
 }
 
 func ServerNew(address string, port string, storage Storage, logger *log.Logger) *_HTTPServer {
@@ -31,25 +70,81 @@ func ServerNew(address string, port string, storage Storage, logger *log.Logger)
 		Strg:    storage,
 		Logger:  logger,
 		Router:  chi.NewRouter(),
+
+		InfluxCounterSuffixes: DefaultInfluxCounterSuffixes,
+		influxTotals:          make(map[string]influxTotal),
+		influxPruned:          time.Now(),
 	}
 }
 
 func (serv *_HTTPServer) InitRoutes() {
+	// порядок важен: агент подписывает, сжимает и шифрует тело, здесь все в обратном порядке
+	serv.Router.Use(serv.DecryptMiddleware)
+	serv.Router.Use(serv.GzipMiddleware)
 
-	serv.Router.Get("/", serv.MetricAll)
+	// Telegraf не умеет подписывать запросы, без подписи их пускаем только если это явно разрешено
+	influxHash := serv.HashMiddleware
+	if serv.InfluxUnsigned {
+		influxHash = serv.OptionalHashMiddleware
+	}
+	serv.Router.With(influxHash).Post("/write", serv.InfluxWrite)
 
-	serv.Router.Route("/update", func(r chi.Router) {
-		r.Post("/{type}/{name}/{value}", serv.MetricSave)
-	})
-	serv.Router.Route("/value", func(r chi.Router) {
-		r.Get("/{type}/{name}", serv.MetricRead)
+	serv.Router.Group(func(r chi.Router) {
+		r.Use(serv.HashMiddleware)
+
+		r.Get("/", serv.MetricAll)
+		r.Get("/ping", serv.Ping)
+		r.Get("/metrics", serv.MetricExport)
+		r.Get("/history/{type}/{name}", serv.MetricHistory)
+		r.Get("/alerts", serv.AlertList)
+		r.Route("/silences", func(r chi.Router) {
+			r.Get("/", serv.SilenceList)
+			r.Post("/", serv.SilenceAdd)
+			r.Delete("/{id}", serv.SilenceDelete)
+		})
+
+		r.Route("/update", func(r chi.Router) {
+			r.Post("/", serv.MetricSaveJSON)
+			r.Post("/{type}/{name}/{value}", serv.MetricSave)
+		})
+		r.Post("/updates/", serv.MetricSaveBatch)
+		r.Route("/value", func(r chi.Router) {
+			r.Post("/", serv.MetricReadJSON)
+			r.Get("/{type}/{name}", serv.MetricRead)
+		})
 	})
 }
 
-func (serv *_HTTPServer) Run() {
-	aP := fmt.Sprintf("%s:%s", serv.Address, serv.Port)
-	err := http.ListenAndServe(aP, serv.Router)
+// How long in-flight requests may take to complete after shutdown is requested
+const shutdownTimeout = 10 * time.Second
+
+// Listens on Address:Port and serves requests until ctx is done
+func (serv *_HTTPServer) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", serv.Address, serv.Port))
 	if err != nil {
-		os.Exit(-1)
+		return err
+	}
+	return serv.Serve(ctx, listener)
+}
+
+// Serves requests on the listener until ctx is done, then stops accepting connections and waits for in-flight requests
+func (serv *_HTTPServer) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{Handler: serv.Router}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
 	}
+
+	serv.Logger.Println("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
 }
@@ -0,0 +1,216 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/influx"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Field names of InfluxDB points ending with one of these become counters by default
+var DefaultInfluxCounterSuffixes = []string{"_total"}
+
+// Totals of series not written for so long are forgotten, the next total becomes the baseline again
+const influxTotalsTTL = time.Hour
+
+// Last total of InfluxDB counter series
+type influxTotal struct {
+	value int64
+	seen  time.Time
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Accepts InfluxDB line protocol, e.g. from Telegraf influxdb output. Every numeric or boolean field
+// becomes a gauge named measurement_field, or just measurement for field "value". Fields whose names
+// end with one of InfluxCounterSuffixes carry cumulative totals, the difference to the previous total
+// is added to the counter. The first total of a series after server start is only taken as the baseline,
+// because the counter may already hold it, e.g. restored from file or database.
+// Tags become labels, timestamps are ignored, string fields are skipped.
+// Nothing is written if some line can't be parsed. Requests are not signed by Telegraf,
+// so /write may be served without HashSHA256 checks, see InfluxUnsigned.
+func (serv *_HTTPServer) InfluxWrite(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	points, err := influx.Parse(req.Body)
+	if err != nil {
+		writeInfluxError(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, undo, err := serv.influxMetrics(points)
+	if err != nil {
+		writeInfluxError(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(metrics) > 0 {
+		if err := serv.Strg.UpdateMetrics(metrics); err != nil {
+			// приращения не записаны, итоги возвращаем, чтобы они пришли со следующим запросом
+			undo()
+			serv.Logger.Println(err)
+			writeInfluxError(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// Converts points to metrics. Counter totals are taken under the lock and remembered at once,
+// so concurrent requests with the same series don't add the same increment twice.
+// The returned undo restores previous totals if the metrics could not be stored.
+func (serv *_HTTPServer) influxMetrics(points []influx.Point) ([]*metric.Metric, func(), error) {
+	serv.influxMu.Lock()
+	defer serv.influxMu.Unlock()
+
+	now := time.Now()
+	serv.pruneInfluxTotals(now)
+
+	totals := make(map[string]int64)
+	var metrics []*metric.Metric
+	for _, p := range points {
+		labels := influxLabels(p.Tags)
+		for field, value := range p.Fields {
+			name := p.Measurement
+			if field != "value" {
+				name += "_" + field
+			}
+
+			number, ok := influxNumber(value)
+			if !ok {
+				continue
+			}
+
+			var m *metric.Metric
+			var err error
+			if serv.isInfluxCounter(name) {
+				key := metric.SeriesKey(name, labels)
+				total := int64(math.Round(number))
+				prev, seen := totals[key]
+				if !seen {
+					var last influxTotal
+					last, seen = serv.influxTotals[key]
+					prev = last.value
+				}
+				totals[key] = total
+				var delta int64
+				if seen {
+					delta = total - prev
+					if delta < 0 {
+						// счетчик на источнике сбросился, считаем с нуля
+						delta = total
+					}
+				}
+				m, err = metric.NewMetric(name, metric.Counter, strconv.FormatInt(delta, 10))
+			} else {
+				m, err = metric.NewMetric(name, metric.Gauge, strconv.FormatFloat(number, 'f', -1, 64))
+			}
+			if err == nil {
+				err = m.SetLabels(labels)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			metrics = append(metrics, m)
+		}
+	}
+
+	replaced := make(map[string]*influxTotal, len(totals))
+	for key, total := range totals {
+		if last, ok := serv.influxTotals[key]; ok {
+			replaced[key] = &last
+		} else {
+			replaced[key] = nil
+		}
+		serv.influxTotals[key] = influxTotal{value: total, seen: now}
+	}
+
+	undo := func() {
+		serv.influxMu.Lock()
+		defer serv.influxMu.Unlock()
+
+		for key, last := range replaced {
+			// итог, пришедший позже в другом запросе, не трогаем
+			if current, ok := serv.influxTotals[key]; !ok || current.value != totals[key] || !current.seen.Equal(now) {
+				continue
+			}
+			if last == nil {
+				delete(serv.influxTotals, key)
+			} else {
+				serv.influxTotals[key] = *last
+			}
+		}
+	}
+
+	return metrics, undo, nil
+}
+
+// Forgets totals of series that are not written anymore. Runs at most once per influxTotalsTTL.
+func (serv *_HTTPServer) pruneInfluxTotals(now time.Time) {
+	if now.Sub(serv.influxPruned) < influxTotalsTTL {
+		return
+	}
+	for key, total := range serv.influxTotals {
+		if now.Sub(total.seen) > influxTotalsTTL {
+			delete(serv.influxTotals, key)
+		}
+	}
+	serv.influxPruned = now
+}
+
+func (serv *_HTTPServer) isInfluxCounter(name string) bool {
+	for _, suffix := range serv.InfluxCounterSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns numeric value of the field, booleans are 1 and 0
+func influxNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Converts tags to labels replacing characters not allowed in label names with underscores
+func influxLabels(tags map[string]string) metric.Labels {
+	if len(tags) == 0 {
+		return nil
+	}
+	labels := make(metric.Labels, len(tags))
+	for key, value := range tags {
+		name := invalidLabelChars.ReplaceAllString(key, "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			name = "_" + name
+		}
+		labels[name] = value
+	}
+	return labels
+}
+
+// InfluxDB clients expect errors as {"error": "..."}
+func writeInfluxError(res http.ResponseWriter, message string, code int) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(code)
+	json.NewEncoder(res).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,149 @@
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Content type of Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Serves all metrics in Prometheus text exposition format
+func (serv *_HTTPServer) MetricExport(res http.ResponseWriter, req *http.Request) {
+	serv.Logger.Println("Request", req.URL.Path)
+
+	metrics, err := serv.Strg.ListMetrics()
+	if err != nil {
+		serv.Logger.Println(err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", prometheusContentType)
+	if err := writePrometheus(res, metrics); err != nil {
+		serv.Logger.Println(err)
+	}
+}
+
+// Writes metrics in Prometheus text format. Series of one metric share the family declared
+// by the first of them. Metrics whose sanitized names collide with other already written
+// metrics are skipped, because a family may be declared only once.
+func writePrometheus(w io.Writer, metrics []*metric.Metric) error {
+	bw := bufio.NewWriter(w)
+	families := make(map[string][2]string, len(metrics)) // sanitized name -> {name, type}
+
+	for _, m := range metrics {
+		mName, mType, mValue := m.GetParams()
+		name := sanitizeMetricName(mName)
+		if family, ok := families[name]; ok && family != [2]string{mName, mType} {
+			continue
+		}
+
+		var (
+			value     float64
+			histogram *metric.HistogramValue
+			err       error
+		)
+		if mType == metric.Histogram {
+			histogram, err = metric.ParseHistogram(mValue)
+		} else {
+			value, err = strconv.ParseFloat(mValue, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("metric %s: %w", m.SeriesKey(), err)
+		}
+
+		if _, ok := families[name]; !ok {
+			families[name] = [2]string{mName, mType}
+			fmt.Fprintf(bw, "# TYPE %s %s\n", name, prometheusType(mType))
+		}
+		if histogram != nil {
+			writePrometheusHistogram(bw, name, m.Labels(), histogram)
+			continue
+		}
+		fmt.Fprintf(bw, "%s%s %s\n", name, formatPrometheusLabels(m.Labels()), formatPrometheusValue(value))
+	}
+
+	return bw.Flush()
+}
+
+// Writes cumulative name_bucket series with le label, then name_sum and name_count
+func writePrometheusHistogram(w io.Writer, name string, labels metric.Labels, h *metric.HistogramValue) {
+	bucketLabels := make(metric.Labels, len(labels)+1)
+	for label, value := range labels {
+		bucketLabels[label] = value
+	}
+
+	var cumulative uint64
+	for i, count := range h.Counts {
+		cumulative += count
+		bucketLabels["le"] = "+Inf"
+		if i < len(h.Bounds) {
+			bucketLabels["le"] = formatPrometheusValue(h.Bounds[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatPrometheusLabels(bucketLabels), cumulative)
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatPrometheusLabels(labels), formatPrometheusValue(h.Sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatPrometheusLabels(labels), h.Count)
+}
+
+// Returns {name="value",...} with escaped values, or empty string if there are no labels
+func formatPrometheusLabels(labels metric.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range labels.Names() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(prometheusLabelEscaper.Replace(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func prometheusType(mType string) string {
+	switch mType {
+	case metric.Gauge, metric.Counter, metric.Histogram:
+		return mType
+	}
+	return "untyped"
+}
+
+// Replaces characters not allowed in Prometheus metric names with underscores
+func sanitizeMetricName(name string) string {
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func formatPrometheusValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -1,13 +1,28 @@
 package httpserver
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bazookajoe1/metrics-collector/internal/alerting"
+	"github.com/bazookajoe1/metrics-collector/internal/encryption"
+	"github.com/bazookajoe1/metrics-collector/internal/hashing"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
 	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,6 +42,21 @@ func testRequest(t *testing.T, ts *httptest.Server, path string, method string)
 	return resp, string(respBody)
 }
 
+func testJSONRequest(t *testing.T, ts *httptest.Server, path string, body string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, string(respBody)
+}
+
 func TestRouter(t *testing.T) {
 	logger := log.New(os.Stdout, "", log.Flags())
 	servStorage := memstorage.NewInMemoryStorage()
@@ -48,6 +78,7 @@ func TestRouter(t *testing.T) {
 		{http.MethodPost, "/update/counter/somecounter/str", "", http.StatusBadRequest},
 		{http.MethodGet, "/update/counter/somecounter/str", "", http.StatusMethodNotAllowed},
 		{http.MethodPost, "/update/counter/somecounter", "404 page not found\n", http.StatusNotFound},
+		{http.MethodGet, "/ping", "database is not configured\n", http.StatusInternalServerError},
 	}
 	for _, v := range testTable {
 		resp, get := testRequest(t, ts, v.url, v.method)
@@ -56,3 +87,764 @@ func TestRouter(t *testing.T) {
 		resp.Body.Close()
 	}
 }
+
+func TestJSONRoutes(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	var testTable = []struct {
+		url    string
+		body   string
+		want   string
+		status int
+	}{
+		{"/update/", `{"id":"g","type":"gauge","value":1.5}`, `{"id":"g","type":"gauge","value":1.5}`, http.StatusOK},
+		{"/update/", `{"id":"c","type":"counter","delta":3}`, `{"id":"c","type":"counter","delta":3}`, http.StatusOK},
+		{"/update/", `{"id":"c","type":"counter","delta":4}`, `{"id":"c","type":"counter","delta":7}`, http.StatusOK},
+		{"/update/", `{"id":"c","type":"counter","value":4}`, "", http.StatusBadRequest},
+		{"/update/", `{"id":"x","type":"unknown","value":4}`, "", http.StatusBadRequest},
+		{"/update/", `not json`, "", http.StatusBadRequest},
+		{"/value/", `{"id":"g","type":"gauge"}`, `{"id":"g","type":"gauge","value":1.5}`, http.StatusOK},
+		{"/value/", `{"id":"c","type":"counter"}`, `{"id":"c","type":"counter","delta":7}`, http.StatusOK},
+		{"/value/", `{"id":"missing","type":"gauge"}`, "", http.StatusNotFound},
+		{"/value/", `{"id":"g","type":"unknown"}`, "", http.StatusBadRequest},
+	}
+	for _, v := range testTable {
+		resp, get := testJSONRequest(t, ts, v.url, v.body)
+		assert.Equal(t, v.status, resp.StatusCode, v.body)
+		if v.status == http.StatusOK {
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			assert.JSONEq(t, v.want, get)
+		}
+	}
+}
+
+func TestBatchRoute(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	resp, _ := testJSONRequest(t, ts, "/updates/",
+		`[{"id":"g","type":"gauge","value":2.5},{"id":"c","type":"counter","delta":1},{"id":"c","type":"counter","delta":2}]`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	value, err := servStorage.ReadMetric("counter", "c", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+	value, err = servStorage.ReadMetric("gauge", "g", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2.5", value)
+
+	// invalid element rejects the whole batch
+	resp, _ = testJSONRequest(t, ts, "/updates/",
+		`[{"id":"c","type":"counter","delta":5},{"id":"bad","type":"gauge"}]`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	value, err = servStorage.ReadMetric("counter", "c", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	_, err := zw.Write([]byte(`{"id":"g","type":"gauge","value":3.5}`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/update/", &body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	respBody, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"g","type":"gauge","value":3.5}`, string(respBody))
+
+	// plain text responses are not compressed
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/value/gauge/g", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	respBody, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "3.5", string(respBody))
+}
+
+func TestHashMiddleware(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.Key = "secret"
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	body := `{"id":"g","type":"gauge","value":1}`
+	var testTable = []struct {
+		sign   string
+		status int
+	}{
+		{hashing.Sign([]byte(body), "secret"), http.StatusOK},
+		{hashing.Sign([]byte(body), "other"), http.StatusBadRequest},
+		{"not hex", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+	for _, v := range testTable {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/update/", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if v.sign != "" {
+			req.Header.Set(hashing.Header, v.sign)
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, v.status, resp.StatusCode, v.sign)
+		if v.status == http.StatusOK {
+			assert.True(t, hashing.Verify(respBody, "secret", resp.Header.Get(hashing.Header)))
+		}
+	}
+
+	// data of the text route is in the path, so the path is signed
+	resp, _ := testRequest(t, ts, "/update/gauge/spoofed/42", http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_, err := servStorage.ReadMetric(metric.Gauge, "spoofed", nil)
+	assert.Error(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/update/counter/c/1", nil)
+	require.NoError(t, err)
+	req.Header.Set(hashing.Header, hashing.Sign([]byte("/update/counter/c/1"), "secret"))
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// hash of another path is not accepted
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/update/counter/c/100", nil)
+	require.NoError(t, err)
+	req.Header.Set(hashing.Header, hashing.Sign([]byte("/update/counter/c/1"), "secret"))
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// unsigned deletes are rejected too, reads don't need the hash
+	resp, _ = testRequest(t, ts, "/silences/123", http.MethodDelete)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = testRequest(t, ts, "/value/counter/c", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDecryptMiddleware(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.Key = "secret"
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	serv.PrivateKey = privateKey
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	// тело собирается так же, как у агента: подпись, сжатие, шифрование
+	send := func(pub *rsa.PublicKey) *http.Response {
+		body := []byte(`[{"id":"g","type":"gauge","value":4.5},{"id":"c","type":"counter","delta":3}]`)
+		sign := hashing.Sign(body, "secret")
+
+		var zipped bytes.Buffer
+		zw := gzip.NewWriter(&zipped)
+		_, err := zw.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		encrypted, err := encryption.Encrypt(pub, zipped.Bytes())
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/updates/", bytes.NewReader(encrypted))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set(hashing.Header, sign)
+		req.Header.Set(encryption.Header, encryption.Scheme)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := send(&privateKey.PublicKey)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	value, err := servStorage.ReadMetric("gauge", "g", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "4.5", value)
+	value, err = servStorage.ReadMetric("counter", "c", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+
+	// encrypted with a key of another server
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	resp = send(&otherKey.PublicKey)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	value, err = servStorage.ReadMetric("counter", "c", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+}
+
+func TestMetricExport(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	for _, url := range []string{
+		"/update/gauge/Alloc/1.5",
+		"/update/gauge/http.latency-p99/0.25",
+		"/update/gauge/9lives/9",
+		"/update/counter/PollCount/3",
+		"/update/counter/PollCount/4",
+		"/update/gauge/http_latency_p99/1", // collides with sanitized name above
+	} {
+		resp, _ := testRequest(t, ts, url, http.MethodPost)
+		require.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+
+	resp, body := testRequest(t, ts, "/metrics", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `# TYPE _9lives gauge
+_9lives 9
+# TYPE Alloc gauge
+Alloc 1.5
+# TYPE http_latency_p99 gauge
+http_latency_p99 0.25
+# TYPE PollCount counter
+PollCount 7
+`, body)
+}
+
+func TestDashboard(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	for _, url := range []string{
+		"/update/gauge/HeapAlloc/2",
+		"/update/gauge/Alloc/1",
+		"/update/counter/PollCount/3",
+		"/update/gauge/<script>/1",
+	} {
+		resp, _ := testRequest(t, ts, url, http.MethodPost)
+		require.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+
+	resp, body := testRequest(t, ts, "/", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `<meta http-equiv="refresh" content="10">`)
+	assert.Contains(t, body, "<h2>gauge (3)</h2>")
+	assert.Contains(t, body, "<h2>counter (1)</h2>")
+	assert.Contains(t, body, "&lt;script&gt;")
+	assert.NotContains(t, body, "<script>")
+	assert.Less(t, strings.Index(body, ">Alloc<"), strings.Index(body, ">HeapAlloc<"))
+
+	resp, body = testRequest(t, ts, "/?filter=heap&refresh=0", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, body, "http-equiv")
+	assert.Contains(t, body, ">HeapAlloc<")
+	assert.NotContains(t, body, ">Alloc<")
+	assert.NotContains(t, body, "PollCount")
+}
+
+func TestMetricHistory(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	servStorage.SetHistoryRetention(2, time.Hour)
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	for _, url := range []string{
+		"/update/gauge/Alloc/1.5",
+		"/update/gauge/Alloc/2.5",
+		"/update/gauge/Alloc/3.5",
+		"/update/counter/PollCount/3",
+		"/update/counter/PollCount/4",
+	} {
+		resp, _ := testRequest(t, ts, url, http.MethodPost)
+		require.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+
+	var history historyResponse
+	resp, body := testRequest(t, ts, "/history/gauge/Alloc", http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &history))
+	assert.Equal(t, "Alloc", history.ID)
+	require.Len(t, history.Samples, 2)
+	assert.Equal(t, 2.5, *history.Samples[0].Value)
+	assert.Equal(t, 3.5, *history.Samples[1].Value)
+
+	resp, body = testRequest(t, ts, "/history/counter/PollCount", http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &history))
+	require.Len(t, history.Samples, 2)
+	assert.Equal(t, int64(7), *history.Samples[1].Delta)
+
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	resp, body = testRequest(t, ts, "/history/gauge/Alloc?from="+future, http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &history))
+	assert.Empty(t, history.Samples)
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/history/gauge/Unknown", http.StatusNotFound},
+		{"/history/summary/Alloc", http.StatusBadRequest},
+		{"/history/gauge/Alloc?to=yesterday", http.StatusBadRequest},
+		{"/history/gauge/Alloc?from=2024-01-01T00:00:00Z", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, _ := testRequest(t, ts, tt.url, http.MethodGet)
+		assert.Equal(t, tt.code, resp.StatusCode, tt.url)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	resp, _ := testJSONRequest(t, ts, "/updates/", `[
+		{"id":"Alloc","type":"gauge","value":1.5,"labels":{"host":"web-1"}},
+		{"id":"Alloc","type":"gauge","value":2.5,"labels":{"host":"web-2"}},
+		{"id":"Alloc","type":"gauge","value":3.5},
+		{"id":"PollCount","type":"counter","delta":3,"labels":{"host":"web-1","env":"prod"}}
+	]`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// series with the same name but different labels do not overwrite each other
+	resp, body := testJSONRequest(t, ts, "/value/", `{"id":"Alloc","type":"gauge","labels":{"host":"web-2"}}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"id":"Alloc","type":"gauge","value":2.5,"labels":{"host":"web-2"}}`, body)
+
+	resp, body = testJSONRequest(t, ts, "/update/", `{"id":"PollCount","type":"counter","delta":4,"labels":{"env":"prod","host":"web-1"}}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"id":"PollCount","type":"counter","delta":7,"labels":{"env":"prod","host":"web-1"}}`, body)
+
+	resp, body = testRequest(t, ts, "/value/gauge/Alloc?labels=host=web-1", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1.5", body)
+
+	resp, body = testRequest(t, ts, "/value/gauge/Alloc", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "3.5", body)
+
+	resp, _ = testRequest(t, ts, "/value/gauge/Alloc?labels=host=web-3", http.MethodGet)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = testJSONRequest(t, ts, "/update/", `{"id":"Alloc","type":"gauge","value":1,"labels":{"bad-name":"x"}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = testRequest(t, ts, "/metrics", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `# TYPE Alloc gauge
+Alloc 3.5
+Alloc{host="web-1"} 1.5
+Alloc{host="web-2"} 2.5
+# TYPE PollCount counter
+PollCount{env="prod",host="web-1"} 7
+`, body)
+}
+
+func TestHistogram(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	resp, _ := testJSONRequest(t, ts, "/updates/", `[
+		{"id":"Latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,0,0],"sum":0.05,"count":1},"labels":{"host":"web-1"}},
+		{"id":"Latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[0,2,1],"sum":3.5,"count":3},"labels":{"host":"web-1"}}
+	]`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// reports are merged
+	resp, body := testJSONRequest(t, ts, "/value/", `{"id":"Latency","type":"histogram","labels":{"host":"web-1"}}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"id":"Latency","type":"histogram","labels":{"host":"web-1"},
+		"histogram":{"bounds":[0.1,1],"counts":[1,2,1],"sum":3.55,"count":4}}`, body)
+
+	resp, _ = testJSONRequest(t, ts, "/update/", `{"id":"Latency","type":"histogram"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = testJSONRequest(t, ts, "/update/", `{"id":"Latency","type":"histogram","histogram":{"bounds":[1],"counts":[1],"sum":1,"count":1}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = testRequest(t, ts, "/metrics", http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `# TYPE Latency histogram
+Latency_bucket{host="web-1",le="0.1"} 1
+Latency_bucket{host="web-1",le="1"} 3
+Latency_bucket{host="web-1",le="+Inf"} 4
+Latency_sum{host="web-1"} 3.55
+Latency_count{host="web-1"} 4
+`, body)
+}
+
+type fakeAlerter []alerting.Alert
+
+func (f fakeAlerter) Alerts() []alerting.Alert { return f }
+
+func TestAlertList(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	serv := ServerNew("localhost", "8080", memstorage.NewInMemoryStorage(), logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	resp, body := testRequest(t, ts, "/alerts", http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `[]`, body)
+
+	serv.Alerter = fakeAlerter{
+		{Rule: "high_alloc", Metric: "Alloc", Type: "gauge", State: alerting.StateFiring, Value: 150, Op: ">", Threshold: 100},
+		{Rule: "low_sys", Metric: "Sys", Type: "gauge", State: alerting.StatePending, Value: 1, Op: "<", Threshold: 10},
+	}
+
+	var alerts []alerting.Alert
+	resp, body = testRequest(t, ts, "/alerts", http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &alerts))
+	assert.Len(t, alerts, 2)
+
+	resp, body = testRequest(t, ts, "/alerts?state=firing", http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "high_alloc", alerts[0].Rule)
+
+	resp, _ = testRequest(t, ts, "/alerts?state=unknown", http.MethodGet)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSilences(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	serv := ServerNew("localhost", "8080", memstorage.NewInMemoryStorage(), logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, "/silences", http.MethodGet)
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	notifier, err := alerting.NewNotifier(alerting.DefaultNotifierConfig(), logger)
+	require.NoError(t, err)
+	serv.Silencer = notifier
+
+	endsAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	resp, body := testJSONRequest(t, ts, "/silences", `{"rule": "high_alloc", "ends_at": "`+endsAt+`", "comment": "deploy"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var silence alerting.Silence
+	require.NoError(t, json.Unmarshal([]byte(body), &silence))
+	assert.NotEmpty(t, silence.ID)
+
+	resp, _ = testJSONRequest(t, ts, "/silences", `{"ends_at": "`+endsAt+`"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var silences []alerting.Silence
+	resp, body = testRequest(t, ts, "/silences", http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &silences))
+	require.Len(t, silences, 1)
+	assert.Equal(t, "deploy", silences[0].Comment)
+
+	resp, _ = testRequest(t, ts, "/silences/"+silence.ID, http.MethodDelete)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = testRequest(t, ts, "/silences/"+silence.ID, http.MethodDelete)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestInfluxWrite(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := memstorage.NewInMemoryStorage()
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	write := func(body string) *http.Response {
+		resp, err := ts.Client().Post(ts.URL+"/write?db=telegraf", "text/plain", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := write("cpu,host=a,cpu-id=0 usage=12.5,up=true,state=\"ok\" 1700000000000000000\n" +
+		"temp value=21.5\n" +
+		"net,host=a bytes_total=100i\n")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	labels := metric.Labels{"host": "a", "cpu_id": "0"}
+	value, err := servStorage.ReadMetric(metric.Gauge, "cpu_usage", labels)
+	require.NoError(t, err)
+	assert.Equal(t, "12.5", value)
+	value, err = servStorage.ReadMetric(metric.Gauge, "cpu_up", labels)
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+	_, err = servStorage.ReadMetric(metric.Gauge, "cpu_state", labels)
+	assert.Error(t, err, "string fields are skipped")
+	value, err = servStorage.ReadMetric(metric.Gauge, "temp", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "21.5", value)
+
+	// первый итог только запоминается, дальше счетчик получает приращения итога
+	value, err = servStorage.ReadMetric(metric.Counter, "net_bytes_total", metric.Labels{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "0", value)
+	resp = write("net,host=a bytes_total=130i\n")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	value, err = servStorage.ReadMetric(metric.Counter, "net_bytes_total", metric.Labels{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "30", value)
+
+	// ничего не пишется, если хоть одна строка некорректна
+	resp = write("temp value=30\ntemp value=\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	value, err = servStorage.ReadMetric(metric.Gauge, "temp", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "21.5", value)
+
+	// после перезапуска с восстановленным хранилищем итог не добавляется повторно;
+	// ключ не мешает записи, если неподписанные запросы разрешены
+	restarted := ServerNew("localhost", "8080", servStorage, logger)
+	restarted.Key = "secret"
+	restarted.InfluxUnsigned = true
+	restarted.InitRoutes()
+	ts2 := httptest.NewServer(restarted.Router)
+	defer ts2.Close()
+	for _, total := range []string{"160", "175"} {
+		resp, err := ts2.Client().Post(ts2.URL+"/write", "text/plain", strings.NewReader("net,host=a bytes_total="+total+"i\n"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+	value, err = servStorage.ReadMetric(metric.Counter, "net_bytes_total", metric.Labels{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "45", value)
+}
+
+func TestInfluxWrite_Hash(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	body := "temp value=21.5\n"
+
+	var testTable = []struct {
+		name     string
+		unsigned bool
+		sign     string
+		status   int
+	}{
+		{"unsigned rejected by default", false, "", http.StatusBadRequest},
+		{"signed accepted by default", false, hashing.Sign([]byte(body), "secret"), http.StatusNoContent},
+		{"unsigned accepted when allowed", true, "", http.StatusNoContent},
+		{"signed accepted when allowed", true, hashing.Sign([]byte(body), "secret"), http.StatusNoContent},
+		{"wrong hash rejected when allowed", true, hashing.Sign([]byte(body), "other"), http.StatusBadRequest},
+	}
+	for _, v := range testTable {
+		t.Run(v.name, func(t *testing.T) {
+			servStorage := memstorage.NewInMemoryStorage()
+			serv := ServerNew("localhost", "8080", servStorage, logger)
+			serv.Key = "secret"
+			serv.InfluxUnsigned = v.unsigned
+			serv.InitRoutes()
+			ts := httptest.NewServer(serv.Router)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/write", strings.NewReader(body))
+			require.NoError(t, err)
+			if v.sign != "" {
+				req.Header.Set(hashing.Header, v.sign)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, v.status, resp.StatusCode)
+			_, err = servStorage.ReadMetric(metric.Gauge, "temp", nil)
+			assert.Equal(t, v.status == http.StatusNoContent, err == nil)
+		})
+	}
+}
+
+// Fails batch writes while fail is set
+type failingStorage struct {
+	Storage
+	fail bool
+}
+
+func (s *failingStorage) UpdateMetrics(metrics []*metric.Metric) error {
+	if s.fail {
+		return errors.New("storage is unavailable")
+	}
+	return s.Storage.UpdateMetrics(metrics)
+}
+
+func TestInfluxWrite_Totals(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	servStorage := &failingStorage{Storage: memstorage.NewInMemoryStorage()}
+	serv := ServerNew("localhost", "8080", servStorage, logger)
+	serv.InitRoutes()
+	ts := httptest.NewServer(serv.Router)
+	defer ts.Close()
+
+	write := func(total string) int {
+		resp, err := ts.Client().Post(ts.URL+"/write", "text/plain", strings.NewReader("net bytes_total="+total+"i\n"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	read := func() string {
+		value, err := servStorage.ReadMetric(metric.Counter, "net_bytes_total", nil)
+		require.NoError(t, err)
+		return value
+	}
+
+	require.Equal(t, http.StatusNoContent, write("100"))
+
+	// приращение, которое не удалось записать, приходит со следующим итогом
+	servStorage.fail = true
+	require.Equal(t, http.StatusInternalServerError, write("130"))
+	servStorage.fail = false
+	require.Equal(t, http.StatusNoContent, write("150"))
+	assert.Equal(t, "50", read())
+
+	// давно не обновлявшиеся итоги забываются, следующий итог снова только базовый
+	serv.influxMu.Lock()
+	total := serv.influxTotals[metric.SeriesKey("net_bytes_total", nil)]
+	total.seen = total.seen.Add(-2 * influxTotalsTTL)
+	serv.influxTotals[metric.SeriesKey("net_bytes_total", nil)] = total
+	serv.influxPruned = time.Time{}
+	serv.influxMu.Unlock()
+
+	require.Equal(t, http.StatusNoContent, write("1000"))
+	assert.Equal(t, "50", read())
+	serv.influxMu.Lock()
+	assert.Len(t, serv.influxTotals, 1)
+	serv.influxMu.Unlock()
+}
+
+func TestServe_Shutdown(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	serv := ServerNew("127.0.0.1", "0", memstorage.NewInMemoryStorage(), logger)
+	serv.InitRoutes()
+	started := make(chan struct{})
+	serv.Router.Get("/slow", func(res http.ResponseWriter, req *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		res.Write([]byte("done"))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serv.Serve(ctx, listener)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{string(body), err}
+	}()
+
+	// запрос, начатый до остановки, завершается, новые соединения не принимаются
+	<-started
+	cancel()
+	r := <-slow
+	require.NoError(t, r.err)
+	assert.Equal(t, "done", r.body)
+	assert.NoError(t, <-served)
+
+	_, err = http.Get("http://" + listener.Addr().String() + "/ping")
+	assert.Error(t, err)
+
+	// address in use is reported instead of serving
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer occupied.Close()
+	busy := ServerNew("127.0.0.1", strconv.Itoa(occupied.Addr().(*net.TCPAddr).Port), memstorage.NewInMemoryStorage(), logger)
+	assert.Error(t, busy.Run(context.Background()))
+}
@@ -0,0 +1,151 @@
+// Package influx parses InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+package influx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Point is one parsed line. Field values are float64, int64, uint64, bool or string.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any
+	Timestamp   int64 // 0 if not set, precision depends on the writer
+}
+
+// Reads all points, empty lines and comments are skipped. Error names the line it happened at.
+func Parse(r io.Reader) ([]Point, error) {
+	var points []Point
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p, err := ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		points = append(points, *p)
+	}
+	return points, scanner.Err()
+}
+
+// Parses one line of line protocol
+func ParseLine(line string) (*Point, error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, errors.New("want measurement, fields and optional timestamp separated by spaces")
+	}
+
+	p := &Point{Tags: make(map[string]string), Fields: make(map[string]any)}
+
+	series := split(sections[0], ',', false)
+	p.Measurement = unescape(series[0], ", ")
+	if p.Measurement == "" {
+		return nil, errors.New("measurement is empty")
+	}
+	for _, tag := range series[1:] {
+		key, value, err := splitPair(tag)
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: %w", tag, err)
+		}
+		p.Tags[unescape(key, ",= ")] = unescape(value, ",= ")
+	}
+
+	for _, field := range split(sections[1], ',', true) {
+		key, raw, err := splitPair(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+		value, err := parseFieldValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+		p.Fields[unescape(key, ",= ")] = value
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		p.Timestamp = ts
+	}
+	return p, nil
+}
+
+func parseFieldValue(raw string) (any, error) {
+	if raw == "" {
+		return nil, errors.New("value is empty")
+	}
+	if raw[0] == '"' {
+		if len(raw) < 2 || raw[len(raw)-1] != '"' {
+			return nil, errors.New("unterminated string")
+		}
+		return unescape(raw[1:len(raw)-1], `"\`), nil
+	}
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		return strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	case 'u':
+		return strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// Splits key=value at the first unescaped '='
+func splitPair(s string) (string, string, error) {
+	parts := split(s, '=', false)
+	if len(parts) < 2 || parts[0] == "" {
+		return "", "", errors.New("want key=value")
+	}
+	return parts[0], s[len(parts[0])+1:], nil
+}
+
+// Splits s at sep that is not escaped by backslash and, if quoted is set, not inside double quotes
+func split(s string, sep byte, quoted bool) []string {
+	var parts []string
+	start, inQuotes := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++ // экранированный символ пропускаем
+		case quoted && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Removes backslashes before chars
+func unescape(s string, chars string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(chars, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
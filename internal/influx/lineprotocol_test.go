@@ -0,0 +1,67 @@
+package influx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Point
+	}{
+		{
+			line: "cpu,host=a,region=eu usage=1.5,idle=98i 1700000000000000000",
+			want: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "a", "region": "eu"},
+				Fields:      map[string]any{"usage": 1.5, "idle": int64(98)},
+				Timestamp:   1700000000000000000,
+			},
+		},
+		{
+			line: `disk\ io,path=/mnt/my\ disk,k\=1=v\,2 read=5u,ok=t,msg="a \"quoted\", spaced=value"`,
+			want: Point{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": "/mnt/my disk", "k=1": "v,2"},
+				Fields:      map[string]any{"read": uint64(5), "ok": true, "msg": `a "quoted", spaced=value`},
+			},
+		},
+		{
+			line: "mem value=-3e2",
+			want: Point{Measurement: "mem", Tags: map[string]string{}, Fields: map[string]any{"value": -300.0}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseLine(tt.line)
+		require.NoError(t, err, tt.line)
+		assert.Equal(t, tt.want, *got, tt.line)
+	}
+
+	for _, line := range []string{
+		"cpu",
+		"cpu,host usage=1",
+		"cpu usage=",
+		"cpu usage=abc",
+		"cpu usage=1 yesterday",
+		`cpu msg="unterminated`,
+		",host=a usage=1",
+		"cpu usage=1 1 extra",
+	} {
+		_, err := ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParse(t *testing.T) {
+	points, err := Parse(strings.NewReader("# comment\ncpu usage=1\n\nmem used=2i\n"))
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, "mem", points[1].Measurement)
+
+	_, err = Parse(strings.NewReader("cpu usage=1\ncpu usage=\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,136 @@
+// Package lineserver serves line based text protocols over TCP, e.g. StatsD and Graphite plaintext.
+package lineserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Open connections. Once closed, new connections are refused, so a connection accepted
+// right before the listener was closed can't be left open.
+type connSet struct {
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func (s *connSet) add(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *connSet) remove(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+}
+
+func (s *connSet) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+const (
+	maxLineSize  = 64 * 1024 // longer lines close the connection
+	maxBatchSize = 1000      // lines passed to handle at once
+)
+
+// Accepts connections on the listener and passes every received line to handle until ctx is done.
+// Then closes the listener and open connections and returns when handle is no longer called.
+// Errors are logged with the name prefix.
+func Serve(ctx context.Context, listener net.Listener, name string, handle func(line string), logger *log.Logger) {
+	ServeBatches(ctx, listener, name, func(lines []string) {
+		for _, line := range lines {
+			handle(line)
+		}
+	}, logger)
+}
+
+// Same as Serve, but passes lines in batches: all complete lines received from the connection
+// by one read, at most maxBatchSize at once. Handle is called concurrently for different connections.
+func ServeBatches(ctx context.Context, listener net.Listener, name string, handle func(lines []string), logger *log.Logger) {
+	conns := connSet{conns: make(map[net.Conn]struct{})}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Println(name+":", err)
+				}
+				return
+			}
+			if !conns.add(conn) {
+				conn.Close()
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conns.remove(conn)
+				serveConn(conn, name, handle, logger)
+			}()
+		}
+	}()
+
+	<-ctx.Done()
+	listener.Close()
+	conns.closeAll()
+	wg.Wait()
+}
+
+func serveConn(conn net.Conn, name string, handle func(lines []string), logger *log.Logger) {
+	defer conn.Close()
+	reader := bufio.NewReaderSize(conn, maxLineSize)
+	var lines []string
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == nil || (err == io.EOF && len(line) > 0) {
+			lines = append(lines, strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"))
+		}
+		if err != nil {
+			if len(lines) > 0 {
+				handle(lines)
+			}
+			switch {
+			case errors.Is(err, bufio.ErrBufferFull):
+				logger.Println(name+":", "line is too long")
+			case err != io.EOF && !errors.Is(err, net.ErrClosed):
+				logger.Println(name+":", err)
+			}
+			return
+		}
+		// отдаем пачку, когда прочитанные строки кончились, чтобы не ждать следующих
+		if len(lines) >= maxBatchSize || !lineBuffered(reader) {
+			handle(lines)
+			lines = nil
+		}
+	}
+}
+
+// Reports whether the reader holds a complete line, so it can be read without waiting for the connection
+func lineBuffered(reader *bufio.Reader) bool {
+	buffered, _ := reader.Peek(reader.Buffered())
+	return bytes.IndexByte(buffered, '\n') >= 0
+}
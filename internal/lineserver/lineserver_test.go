@@ -0,0 +1,105 @@
+package lineserver
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var lines []string
+	handle := func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Serve(ctx, listener, "test", handle, log.New(io.Discard, "", 0))
+	}()
+
+	// клиент не закрывает соединение, остановка все равно не должна ждать его
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("first\nsecond\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lines) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return while a client kept its connection open")
+	}
+	assert.Equal(t, []string{"first", "second"}, lines)
+
+	// connection was closed by the server
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+}
+
+func TestServeBatches(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var batches [][]string
+	handle := func(lines []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, lines)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeBatches(ctx, listener, "test", handle, log.New(io.Discard, "", 0))
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	// lines written at once come in one batch, the last one is passed when the connection is closed
+	_, err = conn.Write([]byte("first\r\nsecond\nthird\nlast"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batches) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Equal(t, [][]string{{"first", "second", "third"}, {"last"}}, batches)
+}
+
+func TestConnSet_RefusesAfterClose(t *testing.T) {
+	conns := connSet{conns: make(map[net.Conn]struct{})}
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conns.closeAll()
+	assert.False(t, conns.add(server))
+}
@@ -0,0 +1,137 @@
+package metric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// HistogramValue counts observed values in buckets. Bucket i holds values in (Bounds[i-1], Bounds[i]],
+// the last bucket holds everything above the last bound, so there is one more count than bounds.
+// Counts are not cumulative, Prometheus export accumulates them.
+type HistogramValue struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// Creates empty histogram with the given upper bounds of buckets, they must be sorted and unique
+func NewHistogramValue(bounds []float64) (*HistogramValue, error) {
+	h := &HistogramValue{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Parses histogram in the form returned by String
+func ParseHistogram(s string) (*HistogramValue, error) {
+	var h HistogramValue
+	if err := json.Unmarshal([]byte(s), &h); err != nil {
+		return nil, fmt.Errorf("error histogram value: %w", err)
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Returns histogram encoded as JSON, that is how histograms are kept as metric values
+func (h *HistogramValue) String() string {
+	out, _ := json.Marshal(h)
+	return string(out)
+}
+
+func (h *HistogramValue) validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("error histogram: %d counts for %d bounds", len(h.Counts), len(h.Bounds))
+	}
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("error histogram bound: %v", bound)
+		}
+		if i > 0 && bound <= h.Bounds[i-1] {
+			return errors.New("error histogram: bounds must be sorted and unique")
+		}
+	}
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count != h.Count {
+		return fmt.Errorf("error histogram: count %d is not a sum of bucket counts %d", h.Count, count)
+	}
+	return nil
+}
+
+// Adds value to its bucket, NaN is ignored
+func (h *HistogramValue) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	i, _ := slices.BinarySearch(h.Bounds, value)
+	h.Counts[i]++
+	h.Sum += value
+	h.Count++
+}
+
+// Adds counts and sum of other histogram. Returns error if buckets differ.
+func (h *HistogramValue) Merge(other *HistogramValue) error {
+	if !slices.Equal(h.Bounds, other.Bounds) {
+		return errors.New("histogram buckets differ")
+	}
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+	return nil
+}
+
+// Returns observations made since prev was taken from the same histogram.
+// Returns error if buckets differ or prev has more observations.
+func (h *HistogramValue) Sub(prev *HistogramValue) (*HistogramValue, error) {
+	if !slices.Equal(h.Bounds, prev.Bounds) {
+		return nil, errors.New("histogram buckets differ")
+	}
+	delta := &HistogramValue{Bounds: slices.Clone(h.Bounds), Counts: make([]uint64, len(h.Counts))}
+	for i, c := range h.Counts {
+		if c < prev.Counts[i] {
+			return nil, errors.New("histogram has less observations than the previous one")
+		}
+		delta.Counts[i] = c - prev.Counts[i]
+	}
+	delta.Sum = h.Sum - prev.Sum
+	delta.Count = h.Count - prev.Count
+	return delta, nil
+}
+
+// Returns encoded histogram with observations of both. If buckets differ or older one
+// can't be parsed, newer one wins: bucket layout was changed on the reporting side.
+func MergeHistograms(older, newer string) (string, error) {
+	n, err := ParseHistogram(newer)
+	if err != nil {
+		return "", err
+	}
+	o, err := ParseHistogram(older)
+	if err != nil || o.Merge(n) != nil {
+		return n.String(), nil
+	}
+	return o.String(), nil
+}
+
+// Returns short human readable form, e.g. "count=3 sum=1.5"
+func (h *HistogramValue) Summary() string {
+	return fmt.Sprintf("count=%d sum=%g", h.Count, h.Sum)
+}
+
+func checkHistogramValue(value string) error {
+	_, err := ParseHistogram(value)
+	return err
+}
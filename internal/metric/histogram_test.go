@@ -0,0 +1,56 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramValue(t *testing.T) {
+	h, err := NewHistogramValue([]float64{1, 5})
+	require.NoError(t, err)
+
+	for _, v := range []float64{0.5, 1, 3, 10} {
+		h.Observe(v)
+	}
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(4), h.Count)
+	assert.Equal(t, 14.5, h.Sum)
+
+	parsed, err := ParseHistogram(h.String())
+	require.NoError(t, err)
+	assert.Equal(t, h, parsed)
+
+	prev, err := ParseHistogram(h.String())
+	require.NoError(t, err)
+	h.Observe(2)
+	delta, err := h.Sub(prev)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 0}, delta.Counts)
+	assert.Equal(t, 2.0, delta.Sum)
+
+	require.NoError(t, prev.Merge(delta))
+	assert.Equal(t, h, prev)
+
+	_, err = NewHistogramValue([]float64{5, 1})
+	assert.Error(t, err)
+	_, err = ParseHistogram(`{"bounds":[1],"counts":[1,1],"sum":2,"count":3}`)
+	assert.Error(t, err)
+}
+
+func TestMergeHistograms(t *testing.T) {
+	older := `{"bounds":[1],"counts":[1,0],"sum":0.5,"count":1}`
+
+	merged, err := MergeHistograms(older, `{"bounds":[1],"counts":[0,2],"sum":4,"count":2}`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bounds":[1],"counts":[1,2],"sum":4.5,"count":3}`, merged)
+
+	// changed buckets replace the stored histogram
+	merged, err = MergeHistograms(older, `{"bounds":[2],"counts":[1,0],"sum":1,"count":1}`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bounds":[2],"counts":[1,0],"sum":1,"count":1}`, merged)
+
+	_, err = MergeHistograms(older, "1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,95 @@
+package metric
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// JSONMetric is the wire representation of a metric used by the JSON API.
+// Delta is set for counters, Value is set for gauges, Histogram is set for histograms.
+type JSONMetric struct {
+	ID        string          `json:"id"`
+	MType     string          `json:"type"`
+	Delta     *int64          `json:"delta,omitempty"`
+	Value     *float64        `json:"value,omitempty"`
+	Histogram *HistogramValue `json:"histogram,omitempty"`
+	Labels    Labels          `json:"labels,omitempty"`
+}
+
+// Creates metric from its JSON representation. Returns error if the value for the given type is missing.
+func NewMetricFromJSON(jm *JSONMetric) (*Metric, error) {
+	m, err := newMetricFromJSON(jm)
+	if err != nil {
+		return m, err
+	}
+	if err := m.SetLabels(jm.Labels); err != nil {
+		return &Metric{}, err
+	}
+	return m, nil
+}
+
+func newMetricFromJSON(jm *JSONMetric) (*Metric, error) {
+	switch jm.MType {
+	case Gauge:
+		if jm.Value == nil {
+			return &Metric{}, fmt.Errorf("gauge %s has no value", jm.ID)
+		}
+		return NewMetric(jm.ID, jm.MType, strconv.FormatFloat(*jm.Value, 'f', -1, 64))
+	case Counter:
+		if jm.Delta == nil {
+			return &Metric{}, fmt.Errorf("counter %s has no delta", jm.ID)
+		}
+		return NewMetric(jm.ID, jm.MType, strconv.FormatInt(*jm.Delta, 10))
+	case Histogram:
+		if jm.Histogram == nil {
+			return &Metric{}, fmt.Errorf("histogram %s has no buckets", jm.ID)
+		}
+		return NewMetric(jm.ID, jm.MType, jm.Histogram.String())
+	}
+
+	return &Metric{}, fmt.Errorf("error metric type: %v", jm.MType)
+}
+
+// Converts metric params into JSON representation
+func ToJSON(mName, mType, mValue string) (*JSONMetric, error) {
+	jm := &JSONMetric{ID: mName, MType: mType}
+	switch mType {
+	case Gauge:
+		value, err := strconv.ParseFloat(mValue, 64)
+		if err != nil {
+			return nil, err
+		}
+		jm.Value = &value
+	case Counter:
+		delta, err := strconv.ParseInt(mValue, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		jm.Delta = &delta
+	case Histogram:
+		histogram, err := ParseHistogram(mValue)
+		if err != nil {
+			return nil, err
+		}
+		jm.Histogram = histogram
+	default:
+		return nil, fmt.Errorf("error metric type: %v", mType)
+	}
+
+	return jm, nil
+}
+
+// Returns metric in JSON representation
+func (m *Metric) ToJSON() (*JSONMetric, error) {
+	jm, err := ToJSON(m.mName, m.mType, m.mValue)
+	if err != nil {
+		return nil, err
+	}
+	jm.Labels = m.Labels()
+	return jm, nil
+}
+
+// Checks metric type is one of the known types
+func CheckType(mType string) bool {
+	return mType == Gauge || mType == Counter || mType == Histogram
+}
@@ -0,0 +1,131 @@
+package metric
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels are key/value pairs that identify a series together with the metric name, e.g. host or env
+type Labels map[string]string
+
+// Returns labels in canonical form: sorted by name, values quoted, e.g. env="prod",host="a".
+// Equal label sets always give the same string, so it is used as a part of the series key.
+func (l Labels) String() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l[name]))
+	}
+	return b.String()
+}
+
+// Returns names of the labels in sorted order
+func (l Labels) Names() []string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l Labels) copy() Labels {
+	if len(l) == 0 {
+		return nil
+	}
+	copied := make(Labels, len(l))
+	for name, value := range l {
+		copied[name] = value
+	}
+	return copied
+}
+
+// Checks label names: a letter or underscore followed by letters, digits or underscores
+func (l Labels) Validate() error {
+	for name := range l {
+		if !checkLabelName(name) {
+			return fmt.Errorf("error label name: %q", name)
+		}
+	}
+	return nil
+}
+
+// Parses labels from "name=value,name2=value2". Values may be quoted as in canonical form,
+// then they can contain commas. Empty string gives no labels.
+func ParseLabels(s string) (Labels, error) {
+	labels := make(Labels)
+	for rest := strings.TrimSpace(s); rest != ""; {
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q has no value", rest)
+		}
+		name = strings.TrimSpace(name)
+
+		value = strings.TrimLeft(value, " ")
+		if strings.HasPrefix(value, `"`) {
+			quoted, err := strconv.QuotedPrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("label %s: %w", name, err)
+			}
+			rest = strings.TrimSpace(value[len(quoted):])
+			if rest != "" && !strings.HasPrefix(rest, ",") {
+				return nil, fmt.Errorf("label %s: unexpected %q after value", name, rest)
+			}
+			value, _ = strconv.Unquote(quoted)
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			value = strings.TrimSpace(value)
+			rest = "," + rest
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("label %s is duplicated", name)
+		}
+		labels[name] = value
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
+
+// Returns key that identifies the series: the name alone for metrics without labels,
+// otherwise name{labels in canonical form}
+func SeriesKey(mName string, labels Labels) string {
+	if len(labels) == 0 {
+		return mName
+	}
+	return mName + "{" + labels.String() + "}"
+}
+
+func checkLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Labels
+	}{
+		{"", nil},
+		{"host=web-1", Labels{"host": "web-1"}},
+		{" host = web-1 , env=prod ", Labels{"host": "web-1", "env": "prod"}},
+		{`env="prod",host="a,b"`, Labels{"host": "a,b", "env": "prod"}},
+		{"empty=", Labels{"empty": ""}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLabels(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, in := range []string{"host", "1host=a", "host=a,host=b", `host="a`, `host="a"b`} {
+		_, err := ParseLabels(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestLabels_String(t *testing.T) {
+	labels := Labels{"host": `a,"b"`, "env": "prod"}
+	assert.Equal(t, `env="prod",host="a,\"b\""`, labels.String())
+
+	// canonical form is parsed back into the same labels
+	parsed, err := ParseLabels(labels.String())
+	require.NoError(t, err)
+	assert.Equal(t, labels, parsed)
+
+	assert.Equal(t, "Alloc", SeriesKey("Alloc", nil))
+	assert.Equal(t, `Alloc{env="prod",host="a,\"b\""}`, SeriesKey("Alloc", labels))
+}
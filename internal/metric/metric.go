@@ -3,15 +3,19 @@ package metric
 import (
 	"fmt"
 	"strconv"
+	"time"
 )
 
 const Counter = "counter"
 const Gauge = "gauge"
+const Histogram = "histogram"
 
 type Metric struct {
-	mType  string
-	mName  string
-	mValue string
+	mType    string
+	mName    string
+	mValue   string
+	mLabels  Labels
+	mUpdated time.Time // when storage last updated the metric, zero if unknown
 }
 
 func NewMetric(mName, mType, mValue string) (*Metric, error) {
@@ -27,6 +31,11 @@ func NewMetric(mName, mType, mValue string) (*Metric, error) {
 			if err != nil {
 				return &Metric{}, err
 			}
+		case Histogram:
+			err := checkHistogramValue(mValue)
+			if err != nil {
+				return &Metric{}, err
+			}
 		default:
 			return &Metric{}, fmt.Errorf("error metric type: %v", mType)
 		}
@@ -42,6 +51,34 @@ func (m *Metric) GetParams() (string, string, string) {
 	return m.mName, m.mType, m.mValue
 }
 
+// Returns labels of the metric, nil if there are none
+func (m *Metric) Labels() Labels {
+	return m.mLabels.copy()
+}
+
+// Replaces labels of the metric. Returns error if some label name is invalid.
+func (m *Metric) SetLabels(labels Labels) error {
+	if err := labels.Validate(); err != nil {
+		return err
+	}
+	m.mLabels = labels.copy()
+	return nil
+}
+
+// Returns key that identifies the series of the metric: name with labels
+func (m *Metric) SeriesKey() string {
+	return SeriesKey(m.mName, m.mLabels)
+}
+
+// Returns time of the last update known to storage
+func (m *Metric) UpdatedAt() time.Time {
+	return m.mUpdated
+}
+
+func (m *Metric) SetUpdatedAt(t time.Time) {
+	m.mUpdated = t
+}
+
 func (m *Metric) UpdateMetric(value string) error {
 	switch m.mType {
 	case Gauge:
@@ -67,6 +104,12 @@ func (m *Metric) UpdateMetric(value string) error {
 
 		counter += counterIncrement
 		m.mValue = strconv.FormatInt(counter, 10)
+	case Histogram:
+		merged, err := MergeHistograms(m.mValue, value)
+		if err != nil {
+			return err
+		}
+		m.mValue = merged
 	}
 	return nil
 }
@@ -126,3 +169,9 @@ func checkCounterValue(value string) error {
 
 	return nil
 }
+
+// Sample is the value of a metric at some moment
+type Sample struct {
+	Timestamp time.Time
+	Value     string
+}
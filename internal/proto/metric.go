@@ -0,0 +1,106 @@
+package proto
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative metrics.proto
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bazookajoe1/metrics-collector/internal/hashing"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"google.golang.org/protobuf/proto"
+)
+
+var metricTypes = map[string]Metric_Type{
+	metric.Gauge:     Metric_GAUGE,
+	metric.Counter:   Metric_COUNTER,
+	metric.Histogram: Metric_HISTOGRAM,
+}
+
+// Returns protobuf type of the metric type, TYPE_UNSPECIFIED if it is unknown
+func TypeFromString(mType string) Metric_Type {
+	return metricTypes[mType]
+}
+
+// Returns metric type as used by metric package, empty string if it is unspecified
+func (t Metric_Type) MetricType() string {
+	for name, value := range metricTypes {
+		if value == t {
+			return name
+		}
+	}
+	return ""
+}
+
+// Converts metric to its protobuf form
+func FromMetric(m *metric.Metric) (*Metric, error) {
+	mName, mType, mValue := m.GetParams()
+	pm := &Metric{Id: mName, Type: TypeFromString(mType), Labels: m.Labels()}
+	switch pm.Type {
+	case Metric_GAUGE:
+		value, err := strconv.ParseFloat(mValue, 64)
+		if err != nil {
+			return nil, err
+		}
+		pm.Value = value
+	case Metric_COUNTER:
+		delta, err := strconv.ParseInt(mValue, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		pm.Delta = delta
+	case Metric_HISTOGRAM:
+		h, err := metric.ParseHistogram(mValue)
+		if err != nil {
+			return nil, err
+		}
+		pm.Histogram = &Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+	default:
+		return nil, fmt.Errorf("error metric type: %v", mType)
+	}
+	return pm, nil
+}
+
+// Converts protobuf metric to metric, validating it the same way as metrics received over HTTP
+func (pm *Metric) ToMetric() (*metric.Metric, error) {
+	var value string
+	switch pm.GetType() {
+	case Metric_GAUGE:
+		value = strconv.FormatFloat(pm.GetValue(), 'f', -1, 64)
+	case Metric_COUNTER:
+		value = strconv.FormatInt(pm.GetDelta(), 10)
+	case Metric_HISTOGRAM:
+		if pm.GetHistogram() == nil {
+			return nil, fmt.Errorf("histogram %s has no value", pm.GetId())
+		}
+		h := pm.GetHistogram()
+		value = (&metric.HistogramValue{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}).String()
+	default:
+		return nil, fmt.Errorf("error metric type: %v", pm.GetType())
+	}
+
+	m, err := metric.NewMetric(pm.GetId(), pm.GetType().MetricType(), value)
+	if err != nil {
+		return nil, err
+	}
+	return m, m.SetLabels(pm.GetLabels())
+}
+
+// Returns hex encoded HMAC-SHA256 of the message. Deterministic marshaling is used,
+// so both sides get the same bytes for the same message.
+func Sign(msg proto.Message, key string) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return hashing.Sign(data, key), nil
+}
+
+// Checks sign is HMAC-SHA256 of the message
+func Verify(msg proto.Message, key string, sign string) bool {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return false
+	}
+	return hashing.Verify(data, key, sign)
+}
@@ -0,0 +1,102 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// StatsD metric types
+const (
+	typeCounter      = "c"
+	typeGauge        = "g"
+	typeTimer        = "ms"
+	typeHistogram    = "h" // same as timer
+	typeDistribution = "d" // same as timer
+	typeSet          = "s"
+)
+
+// One parsed line, e.g. "api.requests:1|c|@0.5|#method:get"
+type sample struct {
+	name   string
+	labels metric.Labels
+	kind   string
+	value  float64
+	raw    string  // value as sent, members of sets are compared as strings
+	delta  bool    // gauge value with explicit sign changes current value
+	rate   float64 // sample rate in (0, 1]
+}
+
+// Parses line of StatsD protocol: name:value|type[|@rate][|#tag:value,...].
+// DogStatsD tags become labels.
+func parseLine(line string) (*sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("invalid line %q: want name:value|type", line)
+	}
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid line %q: want name:value|type", line)
+	}
+	s := &sample{name: name, kind: fields[1], raw: fields[0], rate: 1}
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q", field)
+			}
+			s.rate = rate
+		case strings.HasPrefix(field, "#"):
+			labels, err := parseTags(field[1:])
+			if err != nil {
+				return nil, err
+			}
+			s.labels = labels
+		default:
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	switch s.kind {
+	case typeSet:
+		return s, nil
+	case typeCounter, typeGauge, typeTimer, typeHistogram, typeDistribution:
+	default:
+		return nil, fmt.Errorf("unknown metric type %q", s.kind)
+	}
+
+	value, err := strconv.ParseFloat(s.raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("invalid value %q", s.raw)
+	}
+	s.value = value
+	// у gauge знак означает изменение, а не отрицательное значение
+	s.delta = s.kind == typeGauge && (s.raw[0] == '+' || s.raw[0] == '-')
+	return s, nil
+}
+
+// Parses tags in the form k:v,k2:v2. Tag without value gets empty value.
+func parseTags(s string) (metric.Labels, error) {
+	labels := make(metric.Labels)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(tag, ":")
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("tag %s is duplicated", name)
+		}
+		labels[name] = value
+	}
+	if len(labels) == 0 {
+		return nil, errors.New("empty tags")
+	}
+	return labels, labels.Validate()
+}
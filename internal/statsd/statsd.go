@@ -0,0 +1,315 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/lineserver"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Storage the aggregated metrics are written to
+type Storage interface {
+	UpdateMetrics([]*metric.Metric) error
+}
+
+// Max size of UDP datagram
+const maxPacketSize = 65535
+
+// Sums of sampled counters are not exact, e.g. nine 1|c|@0.9 give 9.999999999999998,
+// so values this close to an integer are treated as that integer
+const counterEpsilon = 1e-9
+
+// Gauges not set for this many flushes are forgotten, a relative change after that starts from zero
+const gaugeIdleFlushes = 60
+
+type series struct {
+	name   string
+	labels metric.Labels
+}
+
+type counterAgg struct {
+	series
+	sum float64 // includes the fraction left from previous flushes
+}
+
+type gaugeAgg struct {
+	series
+	value   float64
+	updated bool // set since the last flush
+	idle    int  // flushes since the gauge was set
+}
+
+type timerAgg struct {
+	series
+	values []float64
+	count  float64 // count of values corrected by sample rates, includes the fraction left from previous flushes
+}
+
+type setAgg struct {
+	series
+	members map[string]struct{}
+}
+
+// listener accepts StatsD lines over UDP and TCP, aggregates them and writes the result
+// to storage every FlushInterval:
+//   - counters (c) are summed, values are divided by sample rate, the integer part of the sum is added
+//     to a counter and the fraction is carried over to the next interval;
+//   - gauges (g) keep the last value, +N/-N changes it, only gauges set during the interval are written,
+//     gauges not set for gaugeIdleFlushes intervals are forgotten;
+//   - timers (ms, h, d) become name.count counter and name.lower, name.upper, name.mean,
+//     name.median, name.sum and name.upper_90 gauges;
+//   - sets (s) become gauge with the number of unique values seen during the interval.
+type listener struct {
+	Address       string
+	FlushInterval time.Duration
+	Strg          Storage
+	Logger        *log.Logger
+
+	udp *net.UDPConn
+	tcp net.Listener
+
+	mu       sync.Mutex
+	counters map[string]*counterAgg
+	gauges   map[string]*gaugeAgg // kept between flushes for relative changes until idle
+	timers   map[string]*timerAgg
+	sets     map[string]*setAgg
+}
+
+func NewListener(address string, flushInterval time.Duration, storage Storage, logger *log.Logger) *listener {
+	return &listener{
+		Address:       address,
+		FlushInterval: flushInterval,
+		Strg:          storage,
+		Logger:        logger,
+		counters:      make(map[string]*counterAgg),
+		gauges:        make(map[string]*gaugeAgg),
+		timers:        make(map[string]*timerAgg),
+		sets:          make(map[string]*setAgg),
+	}
+}
+
+// Binds UDP and TCP sockets to Address. With port 0 TCP gets the same port chosen for UDP.
+func (l *listener) Listen() error {
+	udpAddr, err := net.ResolveUDPAddr("udp", l.Address)
+	if err != nil {
+		return err
+	}
+	l.udp, err = net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	l.tcp, err = net.Listen("tcp", l.udp.LocalAddr().String())
+	if err != nil {
+		l.udp.Close()
+		return err
+	}
+	l.Address = l.udp.LocalAddr().String()
+	return nil
+}
+
+// Reads metrics from sockets bound by Listen until ctx is done, then flushes what was received
+func (l *listener) Serve(ctx context.Context) {
+	l.Logger.Printf("statsd listening on %s (udp, tcp)", l.Address)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		l.serveUDP()
+	}()
+	go func() {
+		defer wg.Done()
+		lineserver.Serve(ctx, l.tcp, "statsd", l.handleLine, l.Logger)
+	}()
+
+	ticker := time.NewTicker(l.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.udp.Close()
+			wg.Wait()
+			l.Flush()
+			return
+		case <-ticker.C:
+			l.Flush()
+		}
+	}
+}
+
+func (l *listener) serveUDP() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := l.udp.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.Logger.Println("statsd:", err)
+			}
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			l.handleLine(line)
+		}
+	}
+}
+
+// Parses line and adds it to the current interval, invalid lines are logged and dropped
+func (l *listener) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	s, err := parseLine(line)
+	if err != nil {
+		l.Logger.Println("statsd:", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := metric.SeriesKey(s.name, s.labels)
+	ser := series{name: s.name, labels: s.labels}
+	switch s.kind {
+	case typeCounter:
+		agg, ok := l.counters[key]
+		if !ok {
+			agg = &counterAgg{series: ser}
+			l.counters[key] = agg
+		}
+		agg.sum += s.value / s.rate
+	case typeGauge:
+		agg, ok := l.gauges[key]
+		if !ok {
+			agg = &gaugeAgg{series: ser}
+			l.gauges[key] = agg
+		}
+		if s.delta {
+			agg.value += s.value
+		} else {
+			agg.value = s.value
+		}
+		agg.updated = true
+	case typeSet:
+		agg, ok := l.sets[key]
+		if !ok {
+			agg = &setAgg{series: ser, members: make(map[string]struct{})}
+			l.sets[key] = agg
+		}
+		agg.members[s.raw] = struct{}{}
+	default:
+		agg, ok := l.timers[key]
+		if !ok {
+			agg = &timerAgg{series: ser}
+			l.timers[key] = agg
+		}
+		agg.values = append(agg.values, s.value)
+		agg.count += 1 / s.rate
+	}
+}
+
+// Writes metrics aggregated since the previous flush to storage in one batch
+func (l *listener) Flush() {
+	metrics := l.take()
+	if len(metrics) == 0 {
+		return
+	}
+	if err := l.Strg.UpdateMetrics(metrics); err != nil {
+		l.Logger.Println("statsd:", err)
+	}
+}
+
+// Returns metrics of the finished interval and starts a new one
+func (l *listener) take() []*metric.Metric {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var out []*metric.Metric
+	add := func(ser series, suffix, mType, value string) {
+		m, err := metric.NewMetric(ser.name+suffix, mType, value)
+		if err == nil {
+			err = m.SetLabels(ser.labels)
+		}
+		if err != nil {
+			l.Logger.Println("statsd:", err)
+			return
+		}
+		out = append(out, m)
+	}
+	gauge := func(ser series, suffix string, value float64) {
+		add(ser, suffix, metric.Gauge, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	// пишет целую часть, дробная остается до следующего flush
+	counter := func(ser series, suffix string, value float64) float64 {
+		delta := math.Trunc(value + math.Copysign(counterEpsilon, value))
+		if delta != 0 {
+			add(ser, suffix, metric.Counter, strconv.FormatInt(int64(delta), 10))
+		}
+		if rest := value - delta; math.Abs(rest) >= counterEpsilon {
+			return rest
+		}
+		return 0
+	}
+
+	for key, agg := range l.counters {
+		if agg.sum = counter(agg.series, "", agg.sum); agg.sum == 0 {
+			delete(l.counters, key)
+		}
+	}
+	for key, agg := range l.gauges {
+		if agg.updated {
+			gauge(agg.series, "", agg.value)
+			agg.updated = false
+			agg.idle = 0
+			continue
+		}
+		if agg.idle++; agg.idle >= gaugeIdleFlushes {
+			delete(l.gauges, key)
+		}
+	}
+	for _, agg := range l.sets {
+		gauge(agg.series, "", float64(len(agg.members)))
+	}
+	for key, agg := range l.timers {
+		if agg.count = counter(agg.series, ".count", agg.count); agg.count == 0 {
+			delete(l.timers, key)
+		}
+		values := agg.values
+		if len(values) == 0 {
+			continue
+		}
+		agg.values = nil
+		slices.Sort(values)
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		gauge(agg.series, ".lower", values[0])
+		gauge(agg.series, ".upper", values[len(values)-1])
+		gauge(agg.series, ".sum", sum)
+		gauge(agg.series, ".mean", sum/float64(len(values)))
+		gauge(agg.series, ".median", percentile(values, 50))
+		gauge(agg.series, ".upper_90", percentile(values, 90))
+	}
+
+	clear(l.sets)
+	return out
+}
+
+// Returns nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
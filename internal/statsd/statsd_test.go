@@ -0,0 +1,211 @@
+package statsd
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want sample
+	}{
+		{"requests:1|c", sample{name: "requests", kind: typeCounter, value: 1, raw: "1", rate: 1}},
+		{"requests:2|c|@0.5", sample{name: "requests", kind: typeCounter, value: 2, raw: "2", rate: 0.5}},
+		{"temp:3.2|g", sample{name: "temp", kind: typeGauge, value: 3.2, raw: "3.2", rate: 1}},
+		{"temp:-1|g", sample{name: "temp", kind: typeGauge, value: -1, raw: "-1", rate: 1, delta: true}},
+		{"latency:120|ms|#host:a,env:prod", sample{name: "latency", kind: typeTimer, value: 120, raw: "120", rate: 1,
+			labels: metric.Labels{"host": "a", "env": "prod"}}},
+		{"users:alice|s", sample{name: "users", kind: typeSet, raw: "alice", rate: 1}},
+	}
+	for _, tt := range tests {
+		got, err := parseLine(tt.line)
+		require.NoError(t, err, tt.line)
+		assert.Equal(t, tt.want, *got, tt.line)
+	}
+
+	for _, line := range []string{
+		"requests",
+		"requests:1",
+		":1|c",
+		"requests:x|c",
+		"requests:1|x",
+		"requests:1|c|@2",
+		"requests:1|c|#bad-tag:1",
+		"requests:1|c|unknown",
+	} {
+		_, err := parseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+type readStorage interface {
+	ReadMetric(mType string, mName string, labels metric.Labels) (string, error)
+}
+
+func newTestListener() (*listener, readStorage) {
+	strg := memstorage.NewInMemoryStorage()
+	return NewListener("127.0.0.1:0", time.Hour, strg, log.New(io.Discard, "", 0)), strg
+}
+
+func readMetric(t *testing.T, strg readStorage, mType, name string, labels metric.Labels) string {
+	value, err := strg.ReadMetric(mType, name, labels)
+	require.NoError(t, err, name)
+	return value
+}
+
+func TestListener_Aggregation(t *testing.T) {
+	l, strg := newTestListener()
+
+	for _, line := range []string{
+		"requests:1|c",
+		"requests:2|c|@0.5",
+		"requests:1|c|#host:a",
+		"temp:10|g",
+		"temp:+5|g",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+		"latency:10|ms",
+		"latency:20|ms",
+		"latency:30|ms",
+		"latency:40|ms|@0.5",
+		"broken line",
+	} {
+		l.handleLine(line)
+	}
+	l.Flush()
+
+	assert.Equal(t, "5", readMetric(t, strg, metric.Counter, "requests", nil))
+	assert.Equal(t, "1", readMetric(t, strg, metric.Counter, "requests", metric.Labels{"host": "a"}))
+	assert.Equal(t, "15", readMetric(t, strg, metric.Gauge, "temp", nil))
+	assert.Equal(t, "2", readMetric(t, strg, metric.Gauge, "users", nil))
+	assert.Equal(t, "5", readMetric(t, strg, metric.Counter, "latency.count", nil))
+	assert.Equal(t, "10", readMetric(t, strg, metric.Gauge, "latency.lower", nil))
+	assert.Equal(t, "40", readMetric(t, strg, metric.Gauge, "latency.upper", nil))
+	assert.Equal(t, "25", readMetric(t, strg, metric.Gauge, "latency.mean", nil))
+	assert.Equal(t, "20", readMetric(t, strg, metric.Gauge, "latency.median", nil))
+	assert.Equal(t, "40", readMetric(t, strg, metric.Gauge, "latency.upper_90", nil))
+
+	// счетчики копятся в хранилище, относительное изменение gauge идет от последнего значения
+	l.handleLine("requests:3|c")
+	l.handleLine("temp:-20|g")
+	l.Flush()
+	assert.Equal(t, "8", readMetric(t, strg, metric.Counter, "requests", nil))
+	assert.Equal(t, "-5", readMetric(t, strg, metric.Gauge, "temp", nil))
+}
+
+func TestListener_CounterFraction(t *testing.T) {
+	l, strg := newTestListener()
+
+	// 1/0.3 per interval: the fraction is carried over instead of being rounded away
+	for i := 0; i < 3; i++ {
+		l.handleLine("sampled:1|c|@0.3")
+		l.Flush()
+	}
+	assert.Equal(t, "10", readMetric(t, strg, metric.Counter, "sampled", nil))
+
+	// sums below one are written once they add up to one
+	l.handleLine("rare:0.4|c")
+	l.Flush()
+	_, err := strg.ReadMetric(metric.Counter, "rare", nil)
+	assert.Error(t, err)
+	l.handleLine("rare:0.4|c")
+	l.Flush()
+	l.handleLine("rare:0.4|c")
+	l.Flush()
+	assert.Equal(t, "1", readMetric(t, strg, metric.Counter, "rare", nil))
+
+	for i := 0; i < 9; i++ {
+		l.handleLine("exact:1|c|@0.9")
+	}
+	l.Flush()
+	assert.Equal(t, "10", readMetric(t, strg, metric.Counter, "exact", nil))
+	l.mu.Lock()
+	assert.NotContains(t, l.counters, "exact")
+	l.mu.Unlock()
+}
+
+// Storage counting batches written to it
+type countingStorage struct {
+	readStorage
+	Storage
+	batches int
+}
+
+func (s *countingStorage) UpdateMetrics(metrics []*metric.Metric) error {
+	s.batches++
+	return s.Storage.UpdateMetrics(metrics)
+}
+
+func TestListener_FlushBatchAndIdleGauges(t *testing.T) {
+	mem := memstorage.NewInMemoryStorage()
+	strg := &countingStorage{readStorage: mem, Storage: mem}
+	l := NewListener("127.0.0.1:0", time.Hour, strg, log.New(io.Discard, "", 0))
+
+	l.handleLine("requests:1|c")
+	l.handleLine("temp:10|g")
+	l.handleLine("latency:10|ms")
+	l.Flush()
+	assert.Equal(t, 1, strg.batches, "one flush is one write")
+	l.Flush()
+	assert.Equal(t, 1, strg.batches, "nothing to write")
+
+	for i := 1; i < gaugeIdleFlushes; i++ {
+		l.Flush()
+	}
+	l.mu.Lock()
+	assert.NotContains(t, l.gauges, "temp")
+	l.mu.Unlock()
+
+	// забытый gauge меняется относительно нуля
+	l.handleLine("temp:+1|g")
+	l.Flush()
+	assert.Equal(t, "1", readMetric(t, strg, metric.Gauge, "temp", nil))
+}
+
+func TestListener_Network(t *testing.T) {
+	l, strg := newTestListener()
+	require.NoError(t, l.Listen())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(ctx)
+	}()
+
+	udp, err := net.Dial("udp", l.Address)
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("udp.requests:1|c\nudp.temp:3.5|g"))
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", l.Address)
+	require.NoError(t, err)
+	_, err = tcp.Write([]byte("tcp.requests:2|c\ntcp.requests:3|c\n"))
+	require.NoError(t, err)
+	require.NoError(t, tcp.Close())
+
+	// дожидаемся, пока все строки будут приняты, потом последний flush при остановке
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.gauges["udp.temp"] != nil && l.counters["tcp.requests"] != nil && l.counters["tcp.requests"].sum == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, "1", readMetric(t, strg, metric.Counter, "udp.requests", nil))
+	assert.Equal(t, "3.5", readMetric(t, strg, metric.Gauge, "udp.temp", nil))
+	assert.Equal(t, "5", readMetric(t, strg, metric.Counter, "tcp.requests", nil))
+}
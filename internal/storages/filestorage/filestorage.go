@@ -0,0 +1,145 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+)
+
+// Storage that can be written to and restored from a stream, e.g. memstorage
+type DumpableStorage interface {
+	UpdateMetric(*metric.Metric) error
+	UpdateMetrics([]*metric.Metric) error
+	ReadMetric(mType string, mName string, labels metric.Labels) (string, error)
+	ListMetrics() ([]*metric.Metric, error)
+	ReadHistory(mType string, mName string, labels metric.Labels, from, to time.Time) ([]metric.Sample, error)
+	Dump(io.Writer) error
+	Load(io.Reader) error
+}
+
+// fileStorage wraps storage and persists its content into the file
+type fileStorage struct {
+	DumpableStorage
+	FilePath      string
+	StoreInterval time.Duration
+	Logger        *log.Logger
+	mu            sync.Mutex // serializes writes to the file
+}
+
+// Create file storage on top of storage. With restore set the content of filePath is loaded into storage.
+// Zero storeInterval means the file is rewritten synchronously on every update.
+func NewFileStorage(storage DumpableStorage, filePath string, storeInterval time.Duration, restore bool, logger *log.Logger) (*fileStorage, error) {
+	s := &fileStorage{
+		DumpableStorage: storage,
+		FilePath:        filePath,
+		StoreInterval:   storeInterval,
+		Logger:          logger,
+	}
+
+	if restore {
+		err := s.Restore()
+		if errors.Is(err, fs.ErrNotExist) {
+			s.Logger.Println("nothing to restore:", err)
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *fileStorage) UpdateMetric(m *metric.Metric) error {
+	if err := s.DumpableStorage.UpdateMetric(m); err != nil {
+		return err
+	}
+	return s.syncSave()
+}
+
+func (s *fileStorage) UpdateMetrics(metrics []*metric.Metric) error {
+	if err := s.DumpableStorage.UpdateMetrics(metrics); err != nil {
+		return err
+	}
+	return s.syncSave()
+}
+
+// Loads storage content from the file
+func (s *fileStorage) Restore() error {
+	f, err := os.Open(s.FilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return s.Load(f)
+}
+
+// Writes storage content into the file. Data goes to a temporary file first,
+// so a crash in the middle of the write never leaves a broken snapshot.
+func (s *fileStorage) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Dir(s.FilePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.FilePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := s.Dump(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.FilePath)
+}
+
+// Saves storage into the file every StoreInterval until ctx is done. Does nothing when StoreInterval is zero.
+func (s *fileStorage) Run(ctx context.Context) {
+	if s.StoreInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.StoreInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Save(); err != nil {
+			s.Logger.Println(err)
+		}
+	}
+}
+
+// Flushes storage into the file
+func (s *fileStorage) Close() error {
+	return s.Save()
+}
+
+func (s *fileStorage) syncSave() error {
+	if s.StoreInterval > 0 {
+		return nil
+	}
+	return s.Save()
+}
@@ -0,0 +1,86 @@
+package filestorage
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/bazookajoe1/metrics-collector/internal/storages/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(t *testing.T, mName, mType, mValue string) *metric.Metric {
+	m, err := metric.NewMetric(mName, mType, mValue)
+	require.NoError(t, err)
+	return m
+}
+
+func TestFileStorage_SaveRestore(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	path := filepath.Join(t.TempDir(), "db", "metrics.json")
+
+	// zero interval writes the file on every update
+	s, err := NewFileStorage(memstorage.NewInMemoryStorage(), path, 0, true, logger)
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdateMetric(newMetric(t, "Alloc", metric.Gauge, "12.5")))
+	labeled := newMetric(t, "Alloc", metric.Gauge, "20")
+	require.NoError(t, labeled.SetLabels(metric.Labels{"host": "web-1"}))
+	require.NoError(t, s.UpdateMetric(labeled))
+	require.NoError(t, s.UpdateMetrics([]*metric.Metric{
+		newMetric(t, "PollCount", metric.Counter, "3"),
+		newMetric(t, "PollCount", metric.Counter, "4"),
+	}))
+
+	restored, err := NewFileStorage(memstorage.NewInMemoryStorage(), path, 0, true, logger)
+	require.NoError(t, err)
+
+	value, err := restored.ReadMetric(metric.Gauge, "Alloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "12.5", value)
+
+	value, err = restored.ReadMetric(metric.Gauge, "Alloc", metric.Labels{"host": "web-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "20", value)
+
+	value, err = restored.ReadMetric(metric.Counter, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "7", value)
+
+	// restored counters continue from the saved value
+	require.NoError(t, restored.UpdateMetric(newMetric(t, "PollCount", metric.Counter, "1")))
+	value, err = restored.ReadMetric(metric.Counter, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "8", value)
+}
+
+func TestFileStorage_RestoreMissingFile(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	path := filepath.Join(t.TempDir(), "missing.json")
+
+	_, err := NewFileStorage(memstorage.NewInMemoryStorage(), path, 0, true, logger)
+	assert.NoError(t, err)
+}
+
+func TestFileStorage_CloseFlushes(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	// with an interval updates are kept in memory until the next save
+	s, err := NewFileStorage(memstorage.NewInMemoryStorage(), path, time.Hour, true, logger)
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateMetric(newMetric(t, "PollCount", metric.Counter, "5")))
+	assert.NoFileExists(t, path)
+
+	require.NoError(t, s.Close())
+
+	restored, err := NewFileStorage(memstorage.NewInMemoryStorage(), path, time.Hour, true, logger)
+	require.NoError(t, err)
+	value, err := restored.ReadMetric(metric.Counter, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+}
@@ -1,37 +1,93 @@
 package memstorage
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/bazookajoe1/metrics-collector/internal/history"
 	"github.com/bazookajoe1/metrics-collector/internal/metric"
 )
 
+// Name and labels that identify the series
+type series struct {
+	name   string
+	labels metric.Labels
+}
+
+// Values are keyed by series key, that is name with labels, see metric.SeriesKey
 type inMemoryStorage struct {
-	gauge   map[string]string
-	counter map[string]string
-	mu      sync.RWMutex
+	gauge     map[string]string
+	counter   map[string]string
+	histogram map[string]string
+	series    map[string]series       // series key -> name and labels
+	updated   map[[2]string]time.Time // {type, series key} -> time of the last update
+	history   map[[2]string]*history.Ring
+	mu        sync.RWMutex
+
+	historySize int
+	historyAge  time.Duration
 }
 
 func NewInMemoryStorage() *inMemoryStorage {
 	s := &inMemoryStorage{}
 	s.gauge = make(map[string]string)
 	s.counter = make(map[string]string)
+	s.histogram = make(map[string]string)
+	s.series = make(map[string]series)
+	s.updated = make(map[[2]string]time.Time)
+	s.history = make(map[[2]string]*history.Ring)
+	s.historySize = history.DefaultSize
+	s.historyAge = history.DefaultMaxAge
 
 	return s
 }
 
-func (s *inMemoryStorage) ReadMetric(mType string, mName string) (string, error) {
+// Sets how many samples per metric are kept and for how long. Zero size disables history,
+// zero age keeps samples until they are pushed out by newer ones. Collected history is dropped.
+func (s *inMemoryStorage) SetHistoryRetention(size int, age time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.historySize = size
+	s.historyAge = age
+	s.history = make(map[[2]string]*history.Ring)
+}
+
+// Returns samples of the metric between from and to, zero time means no bound
+func (s *inMemoryStorage) ReadHistory(mType string, mName string, labels metric.Labels, from, to time.Time) ([]metric.Sample, error) {
+	// Range drops expired samples, so the write lock is needed
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ring, ok := s.history[[2]string{mType, metric.SeriesKey(mName, labels)}]
+	if !ok {
+		return nil, nil
+	}
+
+	return ring.Range(from, to), nil
+}
+
+func (s *inMemoryStorage) ReadMetric(mType string, mName string, labels metric.Labels) (string, error) {
+	key := metric.SeriesKey(mName, labels)
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	switch mType {
 	case metric.Gauge:
-		if val, ok := s.gauge[mName]; ok {
+		if val, ok := s.gauge[key]; ok {
 			return val, nil
 		}
 	case metric.Counter:
-		if val, ok := s.counter[mName]; ok {
+		if val, ok := s.counter[key]; ok {
+			return val, nil
+		}
+	case metric.Histogram:
+		if val, ok := s.histogram[key]; ok {
 			return val, nil
 		}
 	}
@@ -39,46 +95,178 @@ func (s *inMemoryStorage) ReadMetric(mType string, mName string) (string, error)
 	return "", fmt.Errorf("invalid metric type %s", mType)
 }
 
-func (s *inMemoryStorage) ReadAllMetrics() string {
+// Returns all metrics: gauges, counters, then histograms, each type sorted by name and labels
+func (s *inMemoryStorage) ListMetrics() ([]*metric.Metric, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	out := ""
-	for key, val := range s.gauge {
-		out += fmt.Sprintf("%s: %s\n", key, val)
+	metrics := make([]*metric.Metric, 0, len(s.gauge)+len(s.counter)+len(s.histogram))
+	for _, typed := range []struct {
+		mType  string
+		values map[string]string
+	}{{metric.Gauge, s.gauge}, {metric.Counter, s.counter}, {metric.Histogram, s.histogram}} {
+		keys := make([]string, 0, len(typed.values))
+		for key := range typed.values {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := s.series[keys[i]], s.series[keys[j]]
+			if a.name != b.name {
+				return a.name < b.name
+			}
+			return a.labels.String() < b.labels.String()
+		})
+
+		for _, key := range keys {
+			sr := s.series[key]
+			m, err := metric.NewMetric(sr.name, typed.mType, typed.values[key])
+			if err != nil {
+				return nil, err
+			}
+			if err := m.SetLabels(sr.labels); err != nil {
+				return nil, err
+			}
+			m.SetUpdatedAt(s.updated[[2]string{typed.mType, key}])
+			metrics = append(metrics, m)
+		}
 	}
-	for key, val := range s.counter {
-		out += fmt.Sprintf("%s: %s\n", key, val)
+
+	return metrics, nil
+}
+
+func (s *inMemoryStorage) UpdateMetric(m *metric.Metric) error {
+	// enter critical section
+	s.mu.Lock()
+	s.updateMetric(m)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Applies all metrics under a single lock, so readers never see a partially applied batch
+func (s *inMemoryStorage) UpdateMetrics(metrics []*metric.Metric) error {
+	// enter critical section
+	s.mu.Lock()
+	for _, m := range metrics {
+		s.updateMetric(m)
 	}
+	s.mu.Unlock()
 
-	return out
+	return nil
 }
 
-func (s *inMemoryStorage) UpdateMetric(m *metric.Metric) {
+// Must be called with s.mu locked
+func (s *inMemoryStorage) updateMetric(m *metric.Metric) {
 	// мы заранее понимаем, что все параметры правильные, поэтому ничего проверять не будем
 	mName, mType, mValue := m.GetParams()
+	seriesKey := m.SeriesKey()
 	switch mType {
 	case metric.Gauge:
-		// enter critical section
-		s.mu.Lock()
-		s.gauge[mName] = mValue
-		s.mu.Unlock()
+		s.gauge[seriesKey] = mValue
 
 	case metric.Counter:
-		// enter critical section
-		s.mu.Lock()
-		tempCVal, err := strconv.ParseInt(s.counter[mName], 10, 64)
+		tempCVal, err := strconv.ParseInt(s.counter[seriesKey], 10, 64)
 		if err != nil {
 			tempCVal = 0 // если такого ключа еще нет, то вернет ошибку, т.к. строка пустая
 		}
 
 		counterIncrement, err := strconv.ParseInt(mValue, 10, 64)
 		if err != nil {
-			break
+			return
 		}
 
 		tempCVal += counterIncrement
-		s.counter[mName] = strconv.FormatInt(tempCVal, 10)
-		s.mu.Unlock()
+		mValue = strconv.FormatInt(tempCVal, 10)
+		s.counter[seriesKey] = mValue
+
+	case metric.Histogram:
+		if stored, ok := s.histogram[seriesKey]; ok {
+			merged, err := metric.MergeHistograms(stored, mValue)
+			if err != nil {
+				return
+			}
+			mValue = merged
+		}
+		s.histogram[seriesKey] = mValue
+
+	default:
+		return
+	}
+
+	if _, ok := s.series[seriesKey]; !ok {
+		s.series[seriesKey] = series{name: mName, labels: m.Labels()}
+	}
+	key := [2]string{mType, seriesKey}
+	now := time.Now()
+	s.updated[key] = now
+
+	ring, ok := s.history[key]
+	if !ok {
+		ring = history.NewRing(s.historySize, s.historyAge)
+		s.history[key] = ring
+	}
+	ring.Add(metric.Sample{Timestamp: now, Value: mValue})
+}
+
+// Writes all metrics into w as JSON array
+func (s *inMemoryStorage) Dump(w io.Writer) error {
+	metrics, err := s.ListMetrics()
+	if err != nil {
+		return err
+	}
+
+	out := make([]*metric.JSONMetric, 0, len(metrics))
+	for _, m := range metrics {
+		jm, err := m.ToJSON()
+		if err != nil {
+			return err
+		}
+		out = append(out, jm)
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+// Reads metrics written by Dump from r. Loaded values replace current ones, counters are not summed.
+func (s *inMemoryStorage) Load(r io.Reader) error {
+	var metrics []metric.JSONMetric
+	if err := json.NewDecoder(r).Decode(&metrics); err != nil {
+		return err
+	}
+
+	gauge := make(map[string]string)
+	counter := make(map[string]string)
+	histogram := make(map[string]string)
+	known := make(map[string]series)
+	updated := make(map[[2]string]time.Time)
+	now := time.Now()
+	for i := range metrics {
+		m, err := metric.NewMetricFromJSON(&metrics[i])
+		if err != nil {
+			return err
+		}
+		mName, mType, mValue := m.GetParams()
+		key := m.SeriesKey()
+		switch mType {
+		case metric.Gauge:
+			gauge[key] = mValue
+		case metric.Counter:
+			counter[key] = mValue
+		case metric.Histogram:
+			histogram[key] = mValue
+		}
+		known[key] = series{name: mName, labels: m.Labels()}
+		updated[[2]string{mType, key}] = now
 	}
+
+	// enter critical section
+	s.mu.Lock()
+	s.gauge = gauge
+	s.counter = counter
+	s.histogram = histogram
+	s.series = known
+	s.updated = updated
+	s.mu.Unlock()
+
+	return nil
 }
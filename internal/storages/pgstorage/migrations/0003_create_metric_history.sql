@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS metric_history (
+    id    BIGSERIAL        PRIMARY KEY,
+    name  TEXT             NOT NULL,
+    type  TEXT             NOT NULL,
+    ts    TIMESTAMPTZ      NOT NULL,
+    delta BIGINT,
+    value DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS metric_history_name_type_ts_idx ON metric_history (name, type, ts);
@@ -0,0 +1,8 @@
+-- labels are stored in canonical form, see metric.Labels.String, '' means no labels
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels TEXT NOT NULL DEFAULT '';
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_pkey;
+ALTER TABLE metrics ADD PRIMARY KEY (name, type, labels);
+
+ALTER TABLE metric_history ADD COLUMN IF NOT EXISTS labels TEXT NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS metric_history_name_type_ts_idx;
+CREATE INDEX IF NOT EXISTS metric_history_series_ts_idx ON metric_history (name, type, labels, ts);
@@ -0,0 +1,3 @@
+-- histograms are stored encoded as metric.HistogramValue.String returns them
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS histogram TEXT;
+ALTER TABLE metric_history ADD COLUMN IF NOT EXISTS histogram TEXT;
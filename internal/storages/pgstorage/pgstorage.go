@@ -0,0 +1,340 @@
+package pgstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bazookajoe1/metrics-collector/internal/history"
+	"github.com/bazookajoe1/metrics-collector/internal/metric"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// How long a single storage operation may take
+	defaultTimeout = 5 * time.Second
+	// How often samples out of retention are deleted from history
+	pruneInterval = time.Minute
+)
+
+type pgStorage struct {
+	Pool        *pgxpool.Pool
+	Timeout     time.Duration
+	HistorySize int           // samples kept per metric, 0 disables history
+	HistoryAge  time.Duration // samples older than that are dropped, 0 keeps them
+	Logger      *log.Logger
+}
+
+// Connects to PostgreSQL by dsn and brings the schema up to date
+func NewPgStorage(dsn string, logger *log.Logger) (*pgStorage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &pgStorage{
+		Pool:        pool,
+		Timeout:     defaultTimeout,
+		HistorySize: history.DefaultSize,
+		HistoryAge:  history.DefaultMaxAge,
+		Logger:      logger,
+	}
+	if err := s.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *pgStorage) Close() error {
+	s.Pool.Close()
+	return nil
+}
+
+func (s *pgStorage) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Pool.Ping(ctx)
+}
+
+func (s *pgStorage) UpdateMetric(m *metric.Metric) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.updateMetric(ctx, s.Pool, m)
+}
+
+// Applies all metrics in one transaction
+func (s *pgStorage) UpdateMetrics(metrics []*metric.Metric) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		for _, m := range metrics {
+			if err := s.updateMetric(ctx, tx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *pgStorage) ReadMetric(mType string, mName string, labels metric.Labels) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	var (
+		delta     *int64
+		value     *float64
+		histogram *string
+	)
+	err := s.Pool.QueryRow(ctx,
+		"SELECT delta, value, histogram FROM metrics WHERE name = $1 AND type = $2 AND labels = $3", mName, mType, labels.String()).
+		Scan(&delta, &value, &histogram)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("metric %s of type %s not found", metric.SeriesKey(mName, labels), mType)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return formatValue(mType, delta, value, histogram), nil
+}
+
+// Returns all metrics: gauges, counters, then histograms, each type sorted by name and labels
+func (s *pgStorage) ListMetrics() ([]*metric.Metric, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	rows, err := s.Pool.Query(ctx, `SELECT name, type, labels, delta, value, histogram, updated_at FROM metrics
+		ORDER BY array_position(ARRAY['gauge', 'counter', 'histogram'], type), name, labels`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []*metric.Metric
+	for rows.Next() {
+		var (
+			mName, mType string
+			labels       string
+			delta        *int64
+			value        *float64
+			histogram    *string
+			updated      time.Time
+		)
+		if err := rows.Scan(&mName, &mType, &labels, &delta, &value, &histogram, &updated); err != nil {
+			return nil, err
+		}
+		m, err := metric.NewMetric(mName, mType, formatValue(mType, delta, value, histogram))
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := metric.ParseLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.SetLabels(parsed); err != nil {
+			return nil, err
+		}
+		m.SetUpdatedAt(updated)
+		metrics = append(metrics, m)
+	}
+
+	return metrics, rows.Err()
+}
+
+// Common part of pgxpool.Pool and pgx.Tx
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+const (
+	upsertGauge = `INSERT INTO metrics (name, type, labels, value) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, type, labels) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`
+	upsertCounter = `INSERT INTO metrics (name, type, labels, delta) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, type, labels) DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = now()`
+)
+
+func (s *pgStorage) updateMetric(ctx context.Context, db querier, m *metric.Metric) error {
+	var (
+		query string
+		arg   any
+		err   error
+	)
+	mName, mType, mValue := m.GetParams()
+	switch mType {
+	case metric.Gauge:
+		query = upsertGauge
+		arg, err = strconv.ParseFloat(mValue, 64)
+	case metric.Counter:
+		query = upsertCounter
+		arg, err = strconv.ParseInt(mValue, 10, 64)
+	case metric.Histogram:
+		return s.updateHistogram(ctx, db, mName, m.Labels().String(), mValue)
+	default:
+		return fmt.Errorf("error metric type: %v", mType)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.HistorySize > 0 {
+		// новое значение попадает в историю тем же запросом
+		query = `WITH upserted AS (` + query + ` RETURNING name, type, labels, delta, value, updated_at)
+			INSERT INTO metric_history (name, type, labels, ts, delta, value)
+			SELECT name, type, labels, updated_at, delta, value FROM upserted`
+	}
+
+	_, err = db.Exec(ctx, query, mName, mType, m.Labels().String(), arg)
+	return err
+}
+
+// Histograms are merged in Go, so the stored one is locked until the merged one is written
+func (s *pgStorage) updateHistogram(ctx context.Context, db querier, mName, labels, value string) error {
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		// если ряда еще нет, вставка сразу сохраняет гистограмму; параллельная вставка ждет нашего коммита
+		tag, err := tx.Exec(ctx, `INSERT INTO metrics (name, type, labels, histogram) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (name, type, labels) DO NOTHING`, mName, metric.Histogram, labels, value)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			var stored *string
+			err := tx.QueryRow(ctx, `SELECT histogram FROM metrics
+				WHERE name = $1 AND type = $2 AND labels = $3 FOR UPDATE`, mName, metric.Histogram, labels).Scan(&stored)
+			if err != nil {
+				return err
+			}
+			if stored != nil {
+				if value, err = metric.MergeHistograms(*stored, value); err != nil {
+					return err
+				}
+			}
+			_, err = tx.Exec(ctx, `UPDATE metrics SET histogram = $4, updated_at = now()
+				WHERE name = $1 AND type = $2 AND labels = $3`, mName, metric.Histogram, labels, value)
+			if err != nil {
+				return err
+			}
+		}
+
+		if s.HistorySize > 0 {
+			_, err = tx.Exec(ctx, `INSERT INTO metric_history (name, type, labels, ts, histogram)
+				VALUES ($1, $2, $3, now(), $4)`, mName, metric.Histogram, labels, value)
+		}
+		return err
+	})
+}
+
+// Returns samples of the metric between from and to, zero time means no bound.
+// Retention is applied on read too, because pruning runs only periodically.
+func (s *pgStorage) ReadHistory(mType string, mName string, labels metric.Labels, from, to time.Time) ([]metric.Sample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	if s.HistoryAge > 0 {
+		if deadline := time.Now().Add(-s.HistoryAge); from.Before(deadline) {
+			from = deadline
+		}
+	}
+	var toArg *time.Time
+	if !to.IsZero() {
+		toArg = &to
+	}
+
+	rows, err := s.Pool.Query(ctx, `SELECT ts, delta, value, histogram FROM (
+			SELECT id, ts, delta, value, histogram FROM metric_history
+			WHERE name = $1 AND type = $2 AND labels = $3 ORDER BY ts DESC, id DESC LIMIT $4
+		) h
+		WHERE ts >= $5 AND ($6::timestamptz IS NULL OR ts <= $6)
+		ORDER BY ts, id`, mName, mType, labels.String(), s.HistorySize, from, toArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []metric.Sample
+	for rows.Next() {
+		var (
+			ts        time.Time
+			delta     *int64
+			value     *float64
+			histogram *string
+		)
+		if err := rows.Scan(&ts, &delta, &value, &histogram); err != nil {
+			return nil, err
+		}
+		samples = append(samples, metric.Sample{Timestamp: ts, Value: formatValue(mType, delta, value, histogram)})
+	}
+
+	return samples, rows.Err()
+}
+
+// Sets how many samples per metric are kept and for how long. Zero size disables history,
+// zero age keeps samples until they are pushed out by newer ones.
+func (s *pgStorage) SetHistoryRetention(size int, age time.Duration) {
+	s.HistorySize = size
+	s.HistoryAge = age
+}
+
+// Deletes history samples that are out of retention
+func (s *pgStorage) PruneHistory() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	if s.HistoryAge > 0 {
+		_, err := s.Pool.Exec(ctx, "DELETE FROM metric_history WHERE ts < $1", time.Now().Add(-s.HistoryAge))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := s.Pool.Exec(ctx, `DELETE FROM metric_history h USING (
+			SELECT id, row_number() OVER (PARTITION BY name, type, labels ORDER BY ts DESC, id DESC) AS n
+			FROM metric_history
+		) ranked
+		WHERE h.id = ranked.id AND ranked.n > $1`, s.HistorySize)
+	return err
+}
+
+// Prunes history every pruneInterval until ctx is done
+func (s *pgStorage) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.PruneHistory(); err != nil {
+			s.Logger.Println(err)
+		}
+	}
+}
+
+func formatValue(mType string, delta *int64, value *float64, histogram *string) string {
+	if mType == metric.Counter && delta != nil {
+		return strconv.FormatInt(*delta, 10)
+	}
+	if mType == metric.Histogram && histogram != nil {
+		return *histogram
+	}
+	if value != nil {
+		return strconv.FormatFloat(*value, 'f', -1, 64)
+	}
+	return ""
+}